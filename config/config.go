@@ -18,6 +18,24 @@ type PaymentAsset struct {
 	Amount  string `yaml:"amount" json:"amount"`
 }
 
+// SubscriptionPlan is one of monthly, yearly and lifetime, each with its own
+// prices, the accept_asset_list becomes a lifetime plan when no plan configured.
+type SubscriptionPlan struct {
+	Name   string         `yaml:"name" json:"name"`
+	Assets []PaymentAsset `yaml:"assets" json:"assets"`
+}
+
+// RefundPolicy decides which transfers the group could not accept are returned
+// to the sender, the reasons match the payment results, untraced is a transfer
+// with an unknown trace id, and packet is a packet paid with a wrong asset or amount.
+type RefundPolicy struct {
+	Overpaid  bool `yaml:"overpaid"`
+	Underpaid bool `yaml:"underpaid"`
+	Unknown   bool `yaml:"unknown"`
+	Untraced  bool `yaml:"untraced"`
+	Packet    bool `yaml:"packet"`
+}
+
 type Shortcut struct {
 	Icon    string `yaml:"icon" json:"icon"`
 	LabelEn string `yaml:"label_en" json:"label_en"`
@@ -31,6 +49,19 @@ type ShortcutGroup struct {
 	Items   []Shortcut `yaml:"shortcuts" json:"shortcuts"`
 }
 
+// ModerationRule is one step of the moderation chain, rules are checked in
+// order and the first one that matches decides the action.
+type ModerationRule struct {
+	Name         string   `yaml:"name"`
+	Type         string   `yaml:"type"`
+	Action       string   `yaml:"action"`
+	Categories   []string `yaml:"categories"`
+	Patterns     []string `yaml:"patterns"`
+	AllowDomains []string `yaml:"allow_domains"`
+	DenyDomains  []string `yaml:"deny_domains"`
+	Checks       []string `yaml:"checks"`
+}
+
 type Config struct {
 	Service struct {
 		Name             string `yaml:"name"`
@@ -48,9 +79,12 @@ type Config struct {
 	System struct {
 		MessageShardModifier                       string   `yaml:"message_shard_modifier"`
 		MessageShardSize                           int64    `yaml:"message_shard_size"`
+		MessageRateLimit                           int64    `yaml:"message_rate_limit"`
 		PriceAssetsEnable                          bool     `yaml:"price_asset_enable"`
 		MinimumUsdtPrice                           string   `yaml:"minimum_usdt_price"`
 		MaximumPacketNumber                        int64    `yaml:"maximum_packet_number"`
+		MinimumPacketExpiry                        int64    `yaml:"minimum_packet_expiry"`
+		MaximumPacketExpiry                        int64    `yaml:"maximum_packet_expiry"`
 		AudioMessageEnable                         bool     `yaml:"audio_message_enable"`
 		ImageMessageEnable                         bool     `yaml:"image_message_enable"`
 		VideoMessageEnable                         bool     `yaml:"video_message_enable"`
@@ -61,36 +95,51 @@ type Config struct {
 		DetectLinkEnabled                          bool     `yaml:"detect_link"`
 		KeywordReplyEnable                         bool     `yaml:"keyword_reply_enable"`
 		ImmediateDeleteExpiredDistributedMsgEnable bool     `yaml:"immediate_delete_expired_distributed_msg_enable"`
+		ThreadFollowersOnly                        bool     `yaml:"thread_followers_only"`
 		WhiteList                                  []string `yaml:"white_list"`
 		WhiteMap                                   map[string]bool
 		OperatorList                               []string `yaml:"operator_list"`
 		Operators                                  map[string]bool
-		PayToJoin                                  bool           `yaml:"pay_to_join"`
-		AccpetPaymentAssetList                     []PaymentAsset `yaml:"accept_asset_list"`
+		ModeratorPermissions                       []string           `yaml:"moderator_permissions"`
+		PayToJoin                                  bool               `yaml:"pay_to_join"`
+		AccpetPaymentAssetList                     []PaymentAsset     `yaml:"accept_asset_list"`
+		SubscriptionPlans                          []SubscriptionPlan `yaml:"subscription_plans"`
+		SubscriptionWarningDays                    int64              `yaml:"subscription_warning_days"`
+		MemberInvitationDiscount                   int64              `yaml:"member_invitation_discount"`
+		ReferralRewardPercent                      int64              `yaml:"referral_reward_percent"`
+		RefundPolicy                               RefundPolicy       `yaml:"refund_policy"`
 	} `yaml:"system"`
+	Moderation struct {
+		Rules []ModerationRule `yaml:"rules"`
+	} `yaml:"moderation"`
 	Appearance struct {
 		HomeWelcomeMessage string          `yaml:"home_welcome_message"`
 		HomeShortcutGroups []ShortcutGroup `yaml:"home_shortcut_groups"`
 	} `yaml:"appearance"`
 	MessageTemplate struct {
-		WelcomeMessage          string         `yaml:"welcome_message"`
-		MessageTipsGuest        string         `yaml:"message_tips_guest"`
-		MessageTipsHelp         string         `yaml:"message_tips_help"`
-		GroupRedPacket          string         `yaml:"group_redpacket"`
-		GroupRedPacketShortDesc string         `yaml:"group_redpacket_short_desc"`
-		GroupRedPacketDesc      string         `yaml:"group_redpacket_desc"`
-		GroupOpenedRedPacket    string         `yaml:"group_opened_redpacket"`
-		MessageProhibit         string         `yaml:"message_prohibit"`
-		MessageAllow            string         `yaml:"message_allow"`
-		MessageTipsJoin         string         `yaml:"message_tips_join"`
-		MessageTipsHelpBtn      string         `yaml:"message_tips_help_btn"`
-		MessageTipsUnsubscribe  string         `yaml:"message_tips_unsubscribe"`
-		MessageRewardLabel      string         `yaml:"message_reward_label"`
-		MessageRewardMemo       string         `yaml:"message_reward_memo"`
-		MessageTipsTooMany      string         `yaml:"message_tips_too_many"`
-		MessageCommandsInfo     string         `yaml:"message_commands_info"`
-		MessageCommandsInfoResp string         `yaml:"message_commands_info_resp"`
-		KeywordReplyList        []KeywordReply `yaml:"keyword_reply_list"`
+		WelcomeMessage          string            `yaml:"welcome_message"`
+		MessageTipsGuest        string            `yaml:"message_tips_guest"`
+		MessageTipsHelp         string            `yaml:"message_tips_help"`
+		GroupRedPacket          string            `yaml:"group_redpacket"`
+		GroupRedPacketShortDesc string            `yaml:"group_redpacket_short_desc"`
+		GroupRedPacketDesc      string            `yaml:"group_redpacket_desc"`
+		GroupOpenedRedPacket    string            `yaml:"group_opened_redpacket"`
+		MessageProhibit         string            `yaml:"message_prohibit"`
+		MessageAllow            string            `yaml:"message_allow"`
+		MessageTipsJoin         string            `yaml:"message_tips_join"`
+		MessageTipsHelpBtn      string            `yaml:"message_tips_help_btn"`
+		MessageTipsUnsubscribe  string            `yaml:"message_tips_unsubscribe"`
+		MessageRewardLabel      string            `yaml:"message_reward_label"`
+		MessageRewardMemo       string            `yaml:"message_reward_memo"`
+		MessageReferralMemo     string            `yaml:"message_referral_memo"`
+		MessageTipsTooMany      string            `yaml:"message_tips_too_many"`
+		MessageTipsMuted        string            `yaml:"message_tips_muted"`
+		MessageTipsExpiring     string            `yaml:"message_tips_expiring"`
+		MessageTipsExpired      string            `yaml:"message_tips_expired"`
+		RefundMemos             map[string]string `yaml:"refund_memos"`
+		MessageCommandsInfo     string            `yaml:"message_commands_info"`
+		MessageCommandsInfoResp string            `yaml:"message_commands_info_resp"`
+		KeywordReplyList        []KeywordReply    `yaml:"keyword_reply_list"`
 		Keywords                map[string][]KeywordReplyMessage
 	} `yaml:"message_template"`
 	Mixin struct {
@@ -104,11 +153,12 @@ type Config struct {
 }
 
 type ExportedConfig struct {
-	MixinClientId          string          `json:"mixin_client_id"`
-	HTTPResourceHost       string          `json:"host"`
-	AccpetPaymentAssetList []PaymentAsset  `json:"accept_asset_list"`
-	HomeWelcomeMessage     string          `json:"home_welcome_message"`
-	HomeShortcutGroups     []ShortcutGroup `json:"home_shortcut_groups"`
+	MixinClientId          string             `json:"mixin_client_id"`
+	HTTPResourceHost       string             `json:"host"`
+	AccpetPaymentAssetList []PaymentAsset     `json:"accept_asset_list"`
+	SubscriptionPlans      []SubscriptionPlan `json:"subscription_plans"`
+	HomeWelcomeMessage     string             `json:"home_welcome_message"`
+	HomeShortcutGroups     []ShortcutGroup    `json:"home_shortcut_groups"`
 }
 
 type KeywordReply struct {
@@ -156,6 +206,10 @@ func LoadConfig(dir string) {
 	for _, wl := range AppConfig.System.WhiteList {
 		AppConfig.System.WhiteMap[wl] = true
 	}
+	// plans
+	if len(AppConfig.System.SubscriptionPlans) == 0 && len(AppConfig.System.AccpetPaymentAssetList) > 0 {
+		AppConfig.System.SubscriptionPlans = []SubscriptionPlan{{Name: "lifetime", Assets: AppConfig.System.AccpetPaymentAssetList}}
+	}
 	// keywords
 	AppConfig.MessageTemplate.Keywords = make(map[string][]KeywordReplyMessage)
 	for _, kw := range AppConfig.MessageTemplate.KeywordReplyList {
@@ -163,11 +217,27 @@ func LoadConfig(dir string) {
 	}
 }
 
+// LoadModerationRules reads the moderation rules from config.yaml again without
+// touching AppConfig, so the running chain can be reloaded.
+func LoadModerationRules(dir string) ([]ModerationRule, error) {
+	data, err := ioutil.ReadFile(path.Join(dir, ConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	err = yaml.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return c.Moderation.Rules, nil
+}
+
 func GetExported() ExportedConfig {
 	return ExportedConfig{
 		MixinClientId:          AppConfig.Mixin.ClientId,
 		HTTPResourceHost:       AppConfig.Service.HTTPResourceHost,
 		AccpetPaymentAssetList: AppConfig.System.AccpetPaymentAssetList,
+		SubscriptionPlans:      AppConfig.System.SubscriptionPlans,
 		HomeWelcomeMessage:     AppConfig.Appearance.HomeWelcomeMessage,
 		HomeShortcutGroups:     AppConfig.Appearance.HomeShortcutGroups,
 	}
@@ -0,0 +1,122 @@
+package durable
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	MixinBlazeHost = "mixin-blaze.zeromesh.net"
+	MixinAPIHost   = "mixin-api.zeromesh.net"
+)
+
+// Transport is everything the services need from the Mixin network,
+// the Blaze websocket and the REST endpoints for messages, transfers
+// and attachments.
+type Transport interface {
+	ConnectBlaze(ctx context.Context) (*websocket.Conn, error)
+	PostMessages(ctx context.Context, key string, messages []byte) error
+	CreateTransfer(ctx context.Context, in *bot.TransferInput) error
+	ShowAttachment(ctx context.Context, id string) (*bot.Attachment, error)
+}
+
+type MixinTransport struct {
+	mutex sync.Mutex
+	pool  map[string]*http.Client
+}
+
+func NewMixinTransport() *MixinTransport {
+	return &MixinTransport{pool: make(map[string]*http.Client)}
+}
+
+func (t *MixinTransport) ConnectBlaze(ctx context.Context) (*websocket.Conn, error) {
+	mixin := config.AppConfig.Mixin
+	token, err := bot.SignAuthenticationToken(mixin.ClientId, mixin.SessionId, mixin.SessionKey, "GET", "/", "")
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	header.Add("Authorization", "Bearer "+token)
+	u := url.URL{Scheme: "wss", Host: MixinBlazeHost, Path: "/"}
+	dialer := &websocket.Dialer{
+		Subprotocols: []string{"Mixin-Blaze-1"},
+	}
+	conn, _, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (t *MixinTransport) PostMessages(ctx context.Context, key string, messages []byte) error {
+	mixin := config.AppConfig.Mixin
+	accessToken, err := bot.SignAuthenticationToken(mixin.ClientId, mixin.SessionId, mixin.SessionKey, "POST", "/messages", string(messages))
+	if err != nil {
+		return err
+	}
+	data, err := t.request(ctx, key, "POST", "/messages", messages, accessToken)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Error bot.Error `json:"error"`
+	}
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Error.Code > 0 {
+		return resp.Error
+	}
+	return nil
+}
+
+func (t *MixinTransport) CreateTransfer(ctx context.Context, in *bot.TransferInput) error {
+	mixin := config.AppConfig.Mixin
+	return bot.CreateTransfer(ctx, in, mixin.ClientId, mixin.SessionId, mixin.SessionKey, mixin.SessionAssetPIN, mixin.PinToken)
+}
+
+func (t *MixinTransport) ShowAttachment(ctx context.Context, id string) (*bot.Attachment, error) {
+	mixin := config.AppConfig.Mixin
+	return bot.AttachemntShow(ctx, mixin.ClientId, mixin.SessionId, mixin.SessionKey, id)
+}
+
+func (t *MixinTransport) request(ctx context.Context, key, method, path string, body []byte, accessToken string) ([]byte, error) {
+	t.mutex.Lock()
+	client := t.pool[key]
+	if client == nil {
+		client = &http.Client{Timeout: 3 * time.Second}
+		t.pool[key] = client
+	}
+	t.mutex.Unlock()
+
+	req, err := http.NewRequest(method, "https://"+MixinAPIHost+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return nil, bot.ServerError(ctx, nil)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, bot.Error{Status: resp.StatusCode, Code: resp.StatusCode, Description: http.StatusText(resp.StatusCode)}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,66 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+type attachment struct {
+	AttachmentId string `json:"attachment_id"`
+}
+
+// fetchAttachment returns a reason when the message itself is malformed, and
+// neither data nor reason when the attachment can't be downloaded.
+func fetchAttachment(ctx context.Context, message *models.Message) ([]byte, string) {
+	var a attachment
+	src, err := base64.StdEncoding.DecodeString(message.Data)
+	if err != nil {
+		return nil, "message.Data format error is not Base64"
+	}
+	err = json.Unmarshal(src, &a)
+	if err != nil {
+		session.Logger(ctx).Errorf("fetchAttachment ERROR: %+v", err)
+		return nil, "message.Data Unmarshal error"
+	}
+	att, err := session.Transport(ctx).ShowAttachment(ctx, a.AttachmentId)
+	if err != nil {
+		session.Logger(ctx).Errorf("fetchAttachment ERROR: %+v", err)
+		return nil, fmt.Sprintf("bot.AttachemntShow error: %+v, id: %s", err, a.AttachmentId)
+	}
+
+	url := strings.Replace(att.ViewURL, "assets.zeromesh.net", "s3.cn-north-1.amazonaws.com.cn", 0)
+	session.Logger(ctx).Infof("fetchAttachment attachment ViewURL %s", url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		session.Logger(ctx).Errorf("fetchAttachment ERROR: %+v", err)
+		return nil, ""
+	}
+	rctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(rctx))
+	if err != nil {
+		session.Logger(ctx).Errorf("fetchAttachment ERROR: %+v", err)
+		return nil, ""
+	}
+	defer resp.Body.Close()
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		session.Logger(ctx).Errorf("fetchAttachment StatusCode ERROR: %d", resp.StatusCode)
+		return nil, ""
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		session.Logger(ctx).Errorf("fetchAttachment ERROR: %+v", err)
+		return nil, ""
+	}
+	return data, ""
+}
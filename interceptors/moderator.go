@@ -0,0 +1,279 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"mvdan.cc/xurls"
+)
+
+const (
+	ActionAllow    = "allow"
+	ActionHold     = "hold"
+	ActionReject   = "reject"
+	ActionLeapfrog = "leapfrog"
+
+	RuleTypeKeyword  = "keyword"
+	RuleTypeLink     = "link"
+	RuleTypeImage    = "image"
+	RuleTypeCategory = "category"
+
+	ImageCheckQRCode = "qrcode"
+	ImageCheckAdult  = "adult"
+)
+
+// Moderator returns the action for a message and the reason, a rule that
+// doesn't match returns an empty action so the chain moves on.
+type Moderator interface {
+	Moderate(ctx context.Context, message *models.Message) (string, string)
+}
+
+type Chain struct {
+	mutex sync.RWMutex
+	rules []Moderator
+}
+
+var chain = &Chain{}
+
+func LoadModerator(rules []config.ModerationRule) error {
+	return chain.Reload(rules)
+}
+
+func Moderate(ctx context.Context, message *models.Message) (string, string) {
+	return chain.Moderate(ctx, message)
+}
+
+func NewChain(rules []config.ModerationRule) (*Chain, error) {
+	c := &Chain{}
+	return c, c.Reload(rules)
+}
+
+// Reload replaces all the rules at once, the old chain is kept if any rule
+// is invalid.
+func (c *Chain) Reload(rules []config.ModerationRule) error {
+	if len(rules) == 0 {
+		rules = defaultModerationRules()
+	}
+	moderators := make([]Moderator, len(rules))
+	for i, r := range rules {
+		m, err := buildModerator(r)
+		if err != nil {
+			return err
+		}
+		moderators[i] = m
+	}
+	c.mutex.Lock()
+	c.rules = moderators
+	c.mutex.Unlock()
+	return nil
+}
+
+func (c *Chain) Moderate(ctx context.Context, message *models.Message) (string, string) {
+	c.mutex.RLock()
+	rules := c.rules
+	c.mutex.RUnlock()
+	for _, r := range rules {
+		if action, reason := r.Moderate(ctx, message); action != "" {
+			return action, reason
+		}
+	}
+	return ActionAllow, ""
+}
+
+func defaultModerationRules() []config.ModerationRule {
+	var rules []config.ModerationRule
+	if config.AppConfig.System.DetectLinkEnabled {
+		rules = append(rules, config.ModerationRule{
+			Name:       "detect_link",
+			Type:       RuleTypeLink,
+			Action:     ActionLeapfrog,
+			Categories: []string{models.MessageCategoryPlainText},
+		})
+	}
+	if config.AppConfig.System.DetectQRCodeEnabled {
+		rules = append(rules, config.ModerationRule{
+			Name:       "detect_image",
+			Type:       RuleTypeImage,
+			Action:     ActionLeapfrog,
+			Categories: []string{models.MessageCategoryPlainImage},
+			Checks:     []string{ImageCheckQRCode, ImageCheckAdult},
+		})
+	}
+	return rules
+}
+
+func buildModerator(r config.ModerationRule) (Moderator, error) {
+	switch r.Action {
+	case ActionAllow, ActionHold, ActionReject, ActionLeapfrog:
+	default:
+		return nil, fmt.Errorf("invalid moderation action %s in rule %s", r.Action, r.Name)
+	}
+	base := rule{name: r.Name, action: r.Action, categories: make(map[string]bool)}
+	for _, c := range r.Categories {
+		base.categories[c] = true
+	}
+	switch r.Type {
+	case RuleTypeKeyword:
+		k := &keywordRule{rule: base}
+		for _, p := range r.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid moderation pattern %s in rule %s: %v", p, r.Name, err)
+			}
+			k.patterns = append(k.patterns, re)
+		}
+		return k, nil
+	case RuleTypeLink:
+		return &linkRule{rule: base, allow: lowerDomains(r.AllowDomains), deny: lowerDomains(r.DenyDomains)}, nil
+	case RuleTypeImage:
+		for _, c := range r.Checks {
+			if c != ImageCheckQRCode && c != ImageCheckAdult {
+				return nil, fmt.Errorf("invalid image check %s in rule %s", c, r.Name)
+			}
+		}
+		return &imageRule{rule: base, checks: r.Checks}, nil
+	case RuleTypeCategory:
+		return &categoryRule{rule: base}, nil
+	}
+	return nil, fmt.Errorf("invalid moderation rule type %s in rule %s", r.Type, r.Name)
+}
+
+type rule struct {
+	name       string
+	action     string
+	categories map[string]bool
+}
+
+func (r *rule) applies(category string) bool {
+	return len(r.categories) == 0 || r.categories[category]
+}
+
+type keywordRule struct {
+	rule
+	patterns []*regexp.Regexp
+}
+
+func (r *keywordRule) Moderate(ctx context.Context, message *models.Message) (string, string) {
+	if message.Category != models.MessageCategoryPlainText || !r.applies(message.Category) {
+		return "", ""
+	}
+	data, err := base64.StdEncoding.DecodeString(message.Data)
+	if err != nil {
+		return "", ""
+	}
+	for _, re := range r.patterns {
+		if m := re.Find(data); m != nil {
+			return r.action, fmt.Sprintf("Rule %s: message contains %s", r.name, m)
+		}
+	}
+	return "", ""
+}
+
+type linkRule struct {
+	rule
+	allow []string
+	deny  []string
+}
+
+func (r *linkRule) Moderate(ctx context.Context, message *models.Message) (string, string) {
+	if message.Category != models.MessageCategoryPlainText || !r.applies(message.Category) {
+		return "", ""
+	}
+	data, err := base64.StdEncoding.DecodeString(message.Data)
+	if err != nil {
+		return "", ""
+	}
+	// a domain neither allowed nor denied only matches when there is an allow
+	// list, or no list at all, which catches every link.
+	for _, link := range xurls.Relaxed.FindAllString(string(data), -1) {
+		host := linkHost(link)
+		if matchDomain(host, r.deny) {
+			return r.action, fmt.Sprintf("Rule %s: message contains link %s", r.name, host)
+		}
+		if matchDomain(host, r.allow) {
+			continue
+		}
+		if len(r.allow) > 0 || len(r.deny) == 0 {
+			return r.action, fmt.Sprintf("Rule %s: message contains link %s", r.name, host)
+		}
+	}
+	return "", ""
+}
+
+type imageRule struct {
+	rule
+	checks []string
+}
+
+func (r *imageRule) Moderate(ctx context.Context, message *models.Message) (string, string) {
+	if message.Category != models.MessageCategoryPlainImage || !r.applies(message.Category) {
+		return "", ""
+	}
+	data, reason := fetchAttachment(ctx, message)
+	if reason != "" {
+		return r.action, fmt.Sprintf("Rule %s: %s", r.name, reason)
+	}
+	if data == nil {
+		return "", ""
+	}
+	for _, c := range r.checks {
+		switch c {
+		case ImageCheckQRCode:
+			if b, err := CheckQRCode(ctx, data); b && err == nil {
+				return r.action, fmt.Sprintf("Rule %s: image contains QR Code", r.name)
+			}
+		case ImageCheckAdult:
+			if b, err := CheckSex(ctx, data); b {
+				return r.action, fmt.Sprintf("Rule %s: CheckSex %+v", r.name, err)
+			}
+		}
+	}
+	return "", ""
+}
+
+type categoryRule struct {
+	rule
+}
+
+func (r *categoryRule) Moderate(ctx context.Context, message *models.Message) (string, string) {
+	if !r.applies(message.Category) {
+		return "", ""
+	}
+	return r.action, fmt.Sprintf("Rule %s: category %s", r.name, message.Category)
+}
+
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return strings.ToLower(link)
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// matchDomain matches the host itself and all its subdomains.
+func matchDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerDomains(domains []string) []string {
+	list := make([]string, len(domains))
+	for i, d := range domains {
+		list[i] = strings.ToLower(strings.TrimSpace(d))
+	}
+	return list
+}
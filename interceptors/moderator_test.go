@@ -0,0 +1,73 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeratorChain(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	config.AppConfig = &config.Config{}
+
+	text := func(s string) *models.Message {
+		return &models.Message{Category: models.MessageCategoryPlainText, Data: base64.StdEncoding.EncodeToString([]byte(s))}
+	}
+
+	chain, err := NewChain(nil)
+	assert.Nil(err)
+	action, _ := chain.Moderate(ctx, text("see https://example.com"))
+	assert.Equal(ActionAllow, action)
+	config.AppConfig.System.DetectLinkEnabled = true
+	chain, err = NewChain(nil)
+	assert.Nil(err)
+	action, _ = chain.Moderate(ctx, text("see https://example.com"))
+	assert.Equal(ActionLeapfrog, action)
+
+	rules := []config.ModerationRule{
+		{Name: "stickers", Type: RuleTypeCategory, Action: ActionAllow, Categories: []string{models.MessageCategoryPlainSticker}},
+		{Name: "videos", Type: RuleTypeCategory, Action: ActionReject, Categories: []string{models.MessageCategoryPlainVideo}},
+		{Name: "spam", Type: RuleTypeKeyword, Action: ActionReject, Patterns: []string{"(?i)airdrop", "免费领"}},
+		{Name: "links", Type: RuleTypeLink, Action: ActionHold, AllowDomains: []string{"mixin.one"}},
+		{Name: "bad", Type: RuleTypeLink, Action: ActionReject, DenyDomains: []string{"scam.io"}},
+	}
+	chain, err = NewChain(rules)
+	assert.Nil(err)
+	action, reason := chain.Moderate(ctx, text("FREE AirDrop now"))
+	assert.Equal(ActionReject, action)
+	assert.Contains(reason, "spam")
+	action, _ = chain.Moderate(ctx, text("免费领币"))
+	assert.Equal(ActionReject, action)
+	action, _ = chain.Moderate(ctx, text("open https://www.mixin.one/messenger"))
+	assert.Equal(ActionAllow, action)
+	action, reason = chain.Moderate(ctx, text("open example.com/abc"))
+	assert.Equal(ActionHold, action)
+	assert.Contains(reason, "example.com")
+	action, _ = chain.Moderate(ctx, &models.Message{Category: models.MessageCategoryPlainVideo})
+	assert.Equal(ActionReject, action)
+	action, _ = chain.Moderate(ctx, &models.Message{Category: models.MessageCategoryPlainSticker})
+	assert.Equal(ActionAllow, action)
+	action, _ = chain.Moderate(ctx, text("hello"))
+	assert.Equal(ActionAllow, action)
+
+	chain, err = NewChain([]config.ModerationRule{rules[4]})
+	assert.Nil(err)
+	action, _ = chain.Moderate(ctx, text("open example.com/abc"))
+	assert.Equal(ActionAllow, action)
+	action, _ = chain.Moderate(ctx, text("open http://a.SCAM.io/abc"))
+	assert.Equal(ActionReject, action)
+
+	err = chain.Reload([]config.ModerationRule{{Name: "broken", Type: RuleTypeKeyword, Action: ActionReject, Patterns: []string{"("}}})
+	assert.NotNil(err)
+	action, _ = chain.Moderate(ctx, text("open http://scam.io"))
+	assert.Equal(ActionReject, action)
+	err = chain.Reload([]config.ModerationRule{{Name: "unknown", Type: RuleTypeCategory, Action: "drop"}})
+	assert.NotNil(err)
+	err = chain.Reload([]config.ModerationRule{{Name: "unknown", Type: "vision", Action: ActionReject}})
+	assert.NotNil(err)
+}
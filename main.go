@@ -8,10 +8,14 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/interceptors"
 	"github.com/MixinNetwork/supergroup.mixin.one/services"
 )
 
@@ -48,6 +52,7 @@ func main() {
 			log.Println(err)
 		}
 	default:
+		go reloadModerator(*dir)
 		go func() {
 			hub := services.NewHub(database)
 			err := hub.StartService(*service)
@@ -58,3 +63,19 @@ func main() {
 		http.ListenAndServe(fmt.Sprintf(":%d", config.AppConfig.Service.HTTPListenPort+2000), http.DefaultServeMux)
 	}
 }
+
+func reloadModerator(dir string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		rules, err := config.LoadModerationRules(dir)
+		if err == nil {
+			err = interceptors.LoadModerator(rules)
+		}
+		if err != nil {
+			log.Println("reload moderator", err)
+		} else {
+			log.Println("reload moderator", len(rules))
+		}
+	}
+}
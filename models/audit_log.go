@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	AuditActionBan           = "ban"
+	AuditActionUnban         = "unban"
+	AuditActionKick          = "kick"
+	AuditActionMute          = "mute"
+	AuditActionUnmute        = "unmute"
+	AuditActionDeleteMessage = "delete_message"
+	AuditActionReview        = "review"
+	AuditActionProperty      = "property"
+	AuditActionBroadcaster   = "broadcaster"
+	AuditActionGrantRole     = "grant_role"
+	AuditActionRevokeRole    = "revoke_role"
+
+	AuditLogsLimit = 100
+)
+
+const audit_logs_DDL = `
+CREATE TABLE IF NOT EXISTS audit_logs (
+	log_id             VARCHAR(36) PRIMARY KEY CHECK (log_id ~* '^[0-9a-f-]{36,36}$'),
+	operator_id        VARCHAR(36) NOT NULL CHECK (operator_id ~* '^[0-9a-f-]{36,36}$'),
+	action             VARCHAR(128) NOT NULL,
+	target_id          VARCHAR(512) NOT NULL DEFAULT '',
+	detail             VARCHAR(1024) NOT NULL DEFAULT '',
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_createdx ON audit_logs(created_at);
+CREATE INDEX IF NOT EXISTS audit_logs_operator_createdx ON audit_logs(operator_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_logs_target_createdx ON audit_logs(target_id, created_at);
+`
+
+var auditLogsCols = []string{"log_id", "operator_id", "action", "target_id", "detail", "created_at"}
+
+func (l *AuditLog) values() []interface{} {
+	return []interface{}{l.LogId, l.OperatorId, l.Action, l.TargetId, l.Detail, l.CreatedAt}
+}
+
+func auditLogFromRow(row durable.Row) (*AuditLog, error) {
+	var l AuditLog
+	err := row.Scan(&l.LogId, &l.OperatorId, &l.Action, &l.TargetId, &l.Detail, &l.CreatedAt)
+	return &l, err
+}
+
+type AuditLog struct {
+	LogId      string
+	OperatorId string
+	Action     string
+	TargetId   string
+	Detail     string
+	CreatedAt  time.Time
+}
+
+type AuditLogFilter struct {
+	OperatorId string
+	Action     string
+	TargetId   string
+	Offset     time.Time
+}
+
+func createAuditLogInTx(ctx context.Context, tx *sql.Tx, operatorId, action, targetId, detail string) error {
+	l := &AuditLog{
+		LogId:      bot.UuidNewV4().String(),
+		OperatorId: operatorId,
+		Action:     action,
+		TargetId:   targetId,
+		Detail:     FirstNStringInRune(detail, 1000),
+		CreatedAt:  time.Now(),
+	}
+	params, positions := compileTableQuery(auditLogsCols)
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO audit_logs (%s) VALUES (%s)", params, positions), l.values()...)
+	return err
+}
+
+func (current *User) ReadAuditLogs(ctx context.Context, filter AuditLogFilter) ([]*AuditLog, error) {
+	if !current.Can(PermissionAudit) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if filter.Offset.IsZero() {
+		filter.Offset = time.Now()
+	}
+	conditions := []string{"created_at<$1"}
+	args := []interface{}{filter.Offset}
+	for _, c := range []struct{ col, value string }{
+		{"operator_id", filter.OperatorId},
+		{"action", filter.Action},
+		{"target_id", filter.TargetId},
+	} {
+		if c.value == "" {
+			continue
+		}
+		args = append(args, c.value)
+		conditions = append(conditions, fmt.Sprintf("%s=$%d", c.col, len(args)))
+	}
+	query := fmt.Sprintf("SELECT %s FROM audit_logs WHERE %s ORDER BY created_at DESC LIMIT %d", strings.Join(auditLogsCols, ","), strings.Join(conditions, " AND "), AuditLogsLimit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var logs []*AuditLog
+	for rows.Next() {
+		l, err := auditLogFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
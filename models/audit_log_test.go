@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLogCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "admin", "http://localhost")
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+
+	logs, err := li.ReadAuditLogs(ctx, AuditLogFilter{})
+	assert.NotNil(err)
+	assert.Nil(logs)
+
+	_, err = admin.CreateMute(ctx, li.UserId, time.Hour)
+	assert.Nil(err)
+	err = admin.DeleteMute(ctx, li.UserId)
+	assert.Nil(err)
+	_, err = admin.CreateBlacklist(ctx, li.UserId, "spam")
+	assert.Nil(err)
+	_, err = admin.CreateProperty(ctx, ProhibitedMessage, true)
+	assert.Nil(err)
+
+	logs, err = admin.ReadAuditLogs(ctx, AuditLogFilter{})
+	assert.Nil(err)
+	assert.Len(logs, 4)
+	assert.Equal(AuditActionProperty, logs[0].Action)
+	assert.Equal("true", logs[0].Detail)
+	logs, err = admin.ReadAuditLogs(ctx, AuditLogFilter{TargetId: li.UserId})
+	assert.Nil(err)
+	assert.Len(logs, 3)
+	logs, err = admin.ReadAuditLogs(ctx, AuditLogFilter{Action: AuditActionBan})
+	assert.Nil(err)
+	assert.Len(logs, 1)
+	assert.Equal("spam", logs[0].Detail)
+	assert.Equal(admin.UserId, logs[0].OperatorId)
+	logs, err = admin.ReadAuditLogs(ctx, AuditLogFilter{OperatorId: li.UserId})
+	assert.Nil(err)
+	assert.Len(logs, 0)
+	logs, err = admin.ReadAuditLogs(ctx, AuditLogFilter{Offset: time.Now().Add(-time.Hour)})
+	assert.Nil(err)
+	assert.Len(logs, 0)
+}
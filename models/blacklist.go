@@ -5,35 +5,68 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"strings"
+	"time"
 
 	bot "github.com/MixinNetwork/bot-api-go-client"
-	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 )
 
 const blacklist_DDL = `
 CREATE TABLE IF NOT EXISTS blacklists (
-	user_id	          VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$')
+	user_id	          VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	operator_id       VARCHAR(36) NOT NULL DEFAULT '',
+	reason            VARCHAR(1024) NOT NULL DEFAULT '',
+	full_name         VARCHAR(512) NOT NULL DEFAULT '',
+	identity_number   BIGINT NOT NULL DEFAULT 0,
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
+
+CREATE INDEX IF NOT EXISTS blacklists_createdx ON blacklists(created_at);
 `
 
+var blacklistsCols = []string{"user_id", "operator_id", "reason", "full_name", "identity_number", "created_at"}
+
+func (b *Blacklist) values() []interface{} {
+	return []interface{}{b.UserId, b.OperatorId, b.Reason, b.FullName, b.IdentityNumber, b.CreatedAt}
+}
+
+func blacklistFromRow(row durable.Row) (*Blacklist, error) {
+	var b Blacklist
+	err := row.Scan(&b.UserId, &b.OperatorId, &b.Reason, &b.FullName, &b.IdentityNumber, &b.CreatedAt)
+	return &b, err
+}
+
+// Blacklist keeps the name and identity of the banned user, since the users
+// row is deleted on ban.
 type Blacklist struct {
-	UserId string
+	UserId         string
+	OperatorId     string
+	Reason         string
+	FullName       string
+	IdentityNumber int64
+	CreatedAt      time.Time
 }
 
-func (user *User) CreateBlacklist(ctx context.Context, userId string) (*Blacklist, error) {
+func (user *User) CreateBlacklist(ctx context.Context, userId, reason string) (*Blacklist, error) {
 	_, err := bot.UuidFromString(userId)
 	if err != nil {
 		return nil, session.ForbiddenError(ctx)
 	}
-	if !config.AppConfig.System.Operators[user.UserId] {
+	if !user.Can(PermissionBan) {
 		return nil, nil
 	}
-	if config.AppConfig.System.Operators[userId] {
+	if isOperatorRole(UserRole(userId)) {
 		return nil, nil
 	}
 
-	b := &Blacklist{UserId: userId}
+	b := &Blacklist{
+		UserId:     userId,
+		OperatorId: user.UserId,
+		Reason:     FirstNStringInRune(reason, 1000),
+		CreatedAt:  time.Now(),
+	}
 	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
 		u, err := findUserById(ctx, tx, userId)
 		if err != nil || u == nil {
@@ -44,7 +77,13 @@ func (user *User) CreateBlacklist(ctx context.Context, userId string) (*Blacklis
 		if err != nil {
 			return err
 		}
-		_, err = tx.ExecContext(ctx, "INSERT INTO blacklists (user_id) VALUES ($1)", u.UserId)
+		b.FullName, b.IdentityNumber = u.FullName, u.IdentityNumber
+		params, positions := compileTableQuery(blacklistsCols)
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO blacklists (%s) VALUES (%s)", params, positions), b.values()...)
+		if err != nil {
+			return err
+		}
+		err = createAuditLogInTx(ctx, tx, user.UserId, AuditActionBan, u.UserId, b.Reason)
 		if err != nil {
 			return err
 		}
@@ -57,24 +96,69 @@ func (user *User) CreateBlacklist(ctx context.Context, userId string) (*Blacklis
 	return b, nil
 }
 
+func (user *User) DeleteBlacklist(ctx context.Context, userId string) error {
+	if !user.Can(PermissionBan) {
+		return session.ForbiddenError(ctx)
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		r, err := tx.ExecContext(ctx, "DELETE FROM blacklists WHERE user_id=$1", userId)
+		if err != nil {
+			return err
+		}
+		if count, err := r.RowsAffected(); err != nil || count == 0 {
+			return err
+		}
+		return createAuditLogInTx(ctx, tx, user.UserId, AuditActionUnban, userId, "")
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (user *User) ReadBlacklists(ctx context.Context, offset time.Time, limit int) ([]*Blacklist, error) {
+	if !user.Can(PermissionBan) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if offset.IsZero() {
+		offset = time.Now()
+	}
+	query := fmt.Sprintf("SELECT %s FROM blacklists WHERE created_at<$1 ORDER BY created_at DESC LIMIT $2", strings.Join(blacklistsCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, offset, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var blacklists []*Blacklist
+	for rows.Next() {
+		b, err := blacklistFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		blacklists = append(blacklists, b)
+	}
+	return blacklists, nil
+}
+
 func ReadBlacklist(ctx context.Context, userId string) (*Blacklist, error) {
-	var b Blacklist
-	err := session.Database(ctx).QueryRowContext(ctx, "SELECT user_id from blacklists WHERE user_id=$1", userId).Scan(&b.UserId)
+	query := fmt.Sprintf("SELECT %s FROM blacklists WHERE user_id=$1", strings.Join(blacklistsCols, ","))
+	b, err := blacklistFromRow(session.Database(ctx).QueryRowContext(ctx, query, userId))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
-	return &b, nil
+	return b, nil
 }
 
 func readBlacklistInTx(ctx context.Context, tx *sql.Tx, userId string) (*Blacklist, error) {
-	var b Blacklist
-	err := tx.QueryRowContext(ctx, "SELECT user_id from blacklists WHERE user_id=$1", userId).Scan(&b.UserId)
+	query := fmt.Sprintf("SELECT %s FROM blacklists WHERE user_id=$1", strings.Join(blacklistsCols, ","))
+	b, err := blacklistFromRow(tx.QueryRowContext(ctx, query, userId))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
-	return &b, nil
+	return b, nil
 }
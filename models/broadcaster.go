@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strings"
 	"time"
@@ -32,7 +33,7 @@ type Broadcaster struct {
 }
 
 func (current *User) CreateBroadcaster(ctx context.Context, identity int64) (*User, error) {
-	if !current.isAdmin() {
+	if !current.Can(PermissionBroadcaster) {
 		return nil, session.ForbiddenError(ctx)
 	}
 
@@ -45,7 +46,13 @@ func (current *User) CreateBroadcaster(ctx context.Context, identity int64) (*Us
 	user := users[0]
 
 	query := fmt.Sprintf("INSERT INTO broadcasters(user_id,created_at,updated_at) VALUES ($1,$2,$3) ON CONFLICT (user_id) DO UPDATE SET updated_at=EXCLUDED.updated_at")
-	_, err = session.Database(ctx).ExecContext(ctx, query, user.UserId, time.Now(), time.Now())
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, user.UserId, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+		return createAuditLogInTx(ctx, tx, current.UserId, AuditActionBroadcaster, user.UserId, fmt.Sprint(user.IdentityNumber))
+	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
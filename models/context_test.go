@@ -18,6 +18,18 @@ const (
 )
 
 const (
+	dropLeasesDDL              = `DROP TABLE IF EXISTS leases;`
+	dropReferralRewardsDDL     = `DROP TABLE IF EXISTS referral_rewards;`
+	dropInvitationsDDL         = `DROP TABLE IF EXISTS invitations;`
+	dropRefundsDDL             = `DROP TABLE IF EXISTS refunds;`
+	dropPaymentsDDL            = `DROP TABLE IF EXISTS payments;`
+	dropRolesDDL               = `DROP TABLE IF EXISTS roles;`
+	dropAuditLogsDDL           = `DROP TABLE IF EXISTS audit_logs;`
+	dropMutesDDL               = `DROP TABLE IF EXISTS mutes;`
+	dropMessageReviewsDDL      = `DROP TABLE IF EXISTS message_reviews;`
+	dropScheduledMessagesDDL   = `DROP TABLE IF EXISTS scheduled_messages;`
+	dropThreadFollowersDDL     = `DROP TABLE IF EXISTS thread_followers;`
+	dropThreadsDDL             = `DROP TABLE IF EXISTS threads;`
 	dropRewardsDDL             = `DROP TABLE IF EXISTS rewards;`
 	dropBroadcastersDDL        = `DROP TABLE IF EXISTS broadcasters;`
 	dropPropertiesDDL          = `DROP TABLE IF EXISTS properties;`
@@ -48,12 +60,25 @@ func teardownTestContext(ctx context.Context) {
 		dropPropertiesDDL,
 		dropBroadcastersDDL,
 		dropRewardsDDL,
+		dropThreadsDDL,
+		dropThreadFollowersDDL,
+		dropScheduledMessagesDDL,
+		dropMessageReviewsDDL,
+		dropMutesDDL,
+		dropAuditLogsDDL,
+		dropRolesDDL,
+		dropPaymentsDDL,
+		dropRefundsDDL,
+		dropInvitationsDDL,
+		dropReferralRewardsDDL,
+		dropLeasesDDL,
 	}
 	for _, q := range tables {
 		if _, err := db.Exec(q); err != nil {
 			log.Panicln(err)
 		}
 	}
+	resetMessageShardSizeCache()
 }
 
 func setupTestContext() context.Context {
@@ -78,6 +103,17 @@ func setupTestContext() context.Context {
 		properties_DDL,
 		broadcasters_DDL,
 		rewards_DDL,
+		threads_DDL,
+		scheduled_messages_DDL,
+		message_reviews_DDL,
+		mutes_DDL,
+		audit_logs_DDL,
+		roles_DDL,
+		payments_DDL,
+		refunds_DDL,
+		invitations_DDL,
+		referral_rewards_DDL,
+		leases_DDL,
 	}
 	for _, q := range tables {
 		if _, err := db.Exec(q); err != nil {
@@ -88,5 +124,9 @@ func setupTestContext() context.Context {
 	if err != nil {
 		log.Panicln(err)
 	}
-	return session.WithDatabase(context.Background(), database)
+	ctx := session.WithDatabase(context.Background(), database)
+	if err := LoadRoles(ctx); err != nil {
+		log.Panicln(err)
+	}
+	return ctx
 }
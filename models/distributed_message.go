@@ -17,7 +17,6 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
-	"github.com/gofrs/uuid"
 	"github.com/lib/pq"
 )
 
@@ -25,9 +24,17 @@ const (
 	DistributeSubscriberLimit      = 100
 	ExpiredDistributedMessageLimit = 100
 	PendingDistributedMessageLimit = 20
+	FailedDistributedMessageLimit  = 100
+
+	DistributedMessageMaxAttempts = 8
+	DistributedMessageRetryBase   = 5 * time.Second
+	DistributedMessageRetryMax    = time.Hour
 
 	MessageStatusSent      = "SENT"
 	MessageStatusDelivered = "DELIVERED"
+	MessageStatusReceived  = "RECEIVED"
+	MessageStatusRead      = "READ"
+	MessageStatusFailed    = "FAILED"
 )
 
 const distributed_messages_DDL = `
@@ -42,10 +49,15 @@ CREATE TABLE IF NOT EXISTS distributed_messages (
 	category              VARCHAR(512) NOT NULL,
 	data                  TEXT NOT NULL,
 	status                VARCHAR(512) NOT NULL,
-	created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	attempts              INTEGER NOT NULL DEFAULT 0,
+	next_at               TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+	last_error            VARCHAR(1024) NOT NULL DEFAULT ''
 );
 
 CREATE INDEX IF NOT EXISTS message_shard_statusx ON distributed_messages(shard, status, created_at);
+CREATE INDEX IF NOT EXISTS message_parent_statusx ON distributed_messages(parent_id, status);
+CREATE INDEX IF NOT EXISTS message_status_createdx ON distributed_messages(status, created_at);
 `
 
 var distributedMessagesCols = []string{"message_id", "conversation_id", "recipient_id", "user_id", "parent_id", "quote_message_id", "shard", "category", "data", "status", "created_at"}
@@ -66,6 +78,9 @@ type DistributedMessage struct {
 	Data           string
 	Status         string
 	CreatedAt      time.Time
+
+	Attempts  int64
+	LastError string
 }
 
 func createDistributeMessage(ctx context.Context, messageId, parentId, quoteMessageId, userId, recipientId, category, data string) (*DistributedMessage, error) {
@@ -81,7 +96,7 @@ func createDistributeMessage(ctx context.Context, messageId, parentId, quoteMess
 		Status:         MessageStatusSent,
 		CreatedAt:      time.Now(),
 	}
-	shard, err := shardId(dm.ConversationId, dm.RecipientId)
+	shard, err := shardId(ctx, dm.ConversationId, dm.RecipientId)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +124,15 @@ func (message *Message) Distribute(ctx context.Context) error {
 			return err
 		}
 	}
+	searchText := messageSearchTextFromData(message.Category, message.Data)
+	var followers map[string]bool
+	if message.ThreadId != "" && config.AppConfig.System.ThreadFollowersOnly {
+		var err error
+		followers, err = readThreadFollowers(ctx, message.ThreadId)
+		if err != nil {
+			return session.TransactionError(ctx, err)
+		}
+	}
 	for {
 		users, err := subscribedUsers(ctx, message.LastDistributeAt, DistributeSubscriberLimit)
 		if err != nil {
@@ -137,6 +161,9 @@ func (message *Message) Distribute(ctx context.Context) error {
 				if user.UserId == message.UserId {
 					continue
 				}
+				if followers != nil && !followers[user.UserId] {
+					continue
+				}
 				messageId := UniqueConversationId(user.UserId, message.MessageId)
 				if set[messageId] {
 					continue
@@ -159,7 +186,7 @@ func (message *Message) Distribute(ctx context.Context) error {
 					message.Data = base64.StdEncoding.EncodeToString(data)
 				}
 				conversationId := UniqueConversationId(config.AppConfig.Mixin.ClientId, user.UserId)
-				shard, err := shardId(conversationId, user.UserId)
+				shard, err := shardId(ctx, conversationId, user.UserId)
 				if err != nil {
 					return err
 				}
@@ -189,7 +216,15 @@ func (message *Message) Distribute(ctx context.Context) error {
 				message.LastDistributeAt = time.Now()
 				message.State = MessageStateSuccess
 			}
-			_, err = tx.ExecContext(ctx, "UPDATE messages SET (last_distribute_at, state)=($1, $2) WHERE message_id=$3", message.LastDistributeAt, message.State, message.MessageId)
+			if message.State != MessageStateSuccess {
+				_, err = tx.ExecContext(ctx, "UPDATE messages SET (last_distribute_at, state)=($1, $2) WHERE message_id=$3", message.LastDistributeAt, message.State, message.MessageId)
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE messages SET (last_distribute_at, state, search_text)=($1, $2, $3) WHERE message_id=$4", message.LastDistributeAt, message.State, searchText, message.MessageId)
+			if err != nil || message.Category != MessageCategoryMessageRecall {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE messages SET search_text='' WHERE message_id=$1", recallMessage.MessageId)
 			return err
 		})
 		if err != nil {
@@ -204,10 +239,17 @@ func (message *Message) Distribute(ctx context.Context) error {
 }
 
 func (message *Message) Leapfrog(ctx context.Context, reason string) error {
-	ids := make([]string, 0)
-	for key, _ := range config.AppConfig.System.Operators {
-		ids = append(ids, key)
-	}
+	return message.leapfrog(ctx, reason, MessageStateSuccess)
+}
+
+// Hold forwards the message to operators like Leapfrog, but keeps it out of
+// the group until an operator reviews it.
+func (message *Message) Hold(ctx context.Context, reason string) error {
+	return message.leapfrog(ctx, reason, MessageStateHeld)
+}
+
+func (message *Message) leapfrog(ctx context.Context, reason, state string) error {
+	ids := reviewerIds()
 	messageIds := make([]string, len(ids))
 	for i, id := range ids {
 		messageIds[i] = UniqueConversationId(id, message.MessageId)
@@ -228,7 +270,7 @@ func (message *Message) Leapfrog(ctx context.Context, reason string) error {
 		}
 		dm, err := createDistributeMessage(ctx, messageId, message.MessageId, "", message.UserId, id, message.Category, message.Data)
 		if err != nil {
-			session.TransactionError(ctx, err)
+			return session.TransactionError(ctx, err)
 		}
 		if i > 0 {
 			values.WriteString(",")
@@ -243,12 +285,21 @@ func (message *Message) Leapfrog(ctx context.Context, reason string) error {
 	}
 
 	message.LastDistributeAt = time.Now()
-	message.State = MessageStateSuccess
+	message.State = state
 	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
 		_, err = tx.ExecContext(ctx, "UPDATE messages SET (last_distribute_at, state)=($1, $2) WHERE message_id=$3", message.LastDistributeAt, message.State, message.MessageId)
 		if err != nil {
 			return err
 		}
+		if state == MessageStateHeld {
+			err = createMessageReview(ctx, tx, message, reason)
+			if err != nil {
+				return err
+			}
+		}
+		if values.Len() == 0 {
+			return nil
+		}
 		query := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES %s", strings.Join(distributedMessagesCols, ","), values.String())
 		_, err = tx.ExecContext(ctx, query)
 		return err
@@ -259,6 +310,17 @@ func (message *Message) Leapfrog(ctx context.Context, reason string) error {
 	return nil
 }
 
+// Reject drops the message without delivering it to anyone.
+func (message *Message) Reject(ctx context.Context) error {
+	message.LastDistributeAt = time.Now()
+	message.State = MessageStateSuccess
+	_, err := session.Database(ctx).ExecContext(ctx, "UPDATE messages SET (last_distribute_at, state)=($1, $2) WHERE message_id=$3", message.LastDistributeAt, message.State, message.MessageId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
 func createSystemDistributedMessage(ctx context.Context, tx *sql.Tx, user *User, category, data string) error {
 	if len(data) == 0 {
 		return nil
@@ -276,8 +338,8 @@ func createSystemDistributedMessage(ctx context.Context, tx *sql.Tx, user *User,
 
 func PendingActiveDistributedMessages(ctx context.Context, shard string, limit int64) ([]*DistributedMessage, error) {
 	var messages []*DistributedMessage
-	query := fmt.Sprintf("SELECT %s FROM distributed_messages WHERE shard=$1 AND status=$2 ORDER BY shard,status,created_at LIMIT $3", strings.Join(distributedMessagesCols, ","))
-	rows, err := session.Database(ctx).QueryContext(ctx, query, shard, MessageStatusSent, limit)
+	query := fmt.Sprintf("SELECT %s FROM distributed_messages WHERE shard=$1 AND status=$2 AND next_at<=$3 ORDER BY shard,status,created_at LIMIT $4", strings.Join(distributedMessagesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, shard, MessageStatusSent, time.Now(), limit)
 	if err != nil {
 		return messages, session.TransactionError(ctx, err)
 	}
@@ -296,8 +358,66 @@ func UpdateMessagesStatus(ctx context.Context, messages []*DistributedMessage) e
 	for i, m := range messages {
 		ids[i] = m.MessageId
 	}
-	query := fmt.Sprintf("UPDATE distributed_messages SET status=$1 WHERE message_id IN ('%s')", strings.Join(ids, "','"))
-	_, err := session.Database(ctx).ExecContext(ctx, query, MessageStatusDelivered)
+	query := fmt.Sprintf("UPDATE distributed_messages SET status=$1 WHERE message_id IN ('%s') AND status=$2", strings.Join(ids, "','"))
+	_, err := session.Database(ctx).ExecContext(ctx, query, MessageStatusDelivered, MessageStatusSent)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// UpdateMessagesFailure delays the messages rejected by the API exponentially,
+// and moves them to the dead letter status FAILED after the last attempt.
+func UpdateMessagesFailure(ctx context.Context, messages []*DistributedMessage) error {
+	query := `UPDATE distributed_messages SET (attempts,next_at,last_error,status)=(attempts+1,
+		$1::TIMESTAMPTZ + LEAST($2 * POWER(2, attempts), $3) * INTERVAL '1 second', $4,
+		CASE WHEN attempts+1>=$5 THEN $6 ELSE status END) WHERE message_id=$7 AND status=$8`
+	for _, m := range messages {
+		lastError := m.LastError
+		if len(lastError) > 1024 {
+			lastError = lastError[:1024]
+		}
+		_, err := session.Database(ctx).ExecContext(ctx, query, time.Now(), DistributedMessageRetryBase.Seconds(), DistributedMessageRetryMax.Seconds(), lastError, DistributedMessageMaxAttempts, MessageStatusFailed, m.MessageId, MessageStatusSent)
+		if err != nil {
+			return session.TransactionError(ctx, err)
+		}
+	}
+	return nil
+}
+
+func (current *User) FailedDistributedMessages(ctx context.Context, offset time.Time) ([]*DistributedMessage, error) {
+	if !current.Can(PermissionDelivery) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if offset.IsZero() {
+		offset = time.Now()
+	}
+	query := fmt.Sprintf("SELECT %s,attempts,last_error FROM distributed_messages WHERE status=$1 AND created_at<$2 ORDER BY status,created_at DESC LIMIT %d", strings.Join(distributedMessagesCols, ","), FailedDistributedMessageLimit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, MessageStatusFailed, offset)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var messages []*DistributedMessage
+	for rows.Next() {
+		var m DistributedMessage
+		err := rows.Scan(&m.MessageId, &m.ConversationId, &m.RecipientId, &m.UserId, &m.ParentId, &m.QuoteMessageId, &m.Shard, &m.Category, &m.Data, &m.Status, &m.CreatedAt, &m.Attempts, &m.LastError)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		messages = append(messages, &m)
+	}
+	return messages, nil
+}
+
+// RetryDistributedMessage queues a dead letter again with the attempts reset.
+func (current *User) RetryDistributedMessage(ctx context.Context, messageId string) error {
+	if !current.Can(PermissionDelivery) {
+		return session.ForbiddenError(ctx)
+	}
+	query := "UPDATE distributed_messages SET (status,attempts,next_at,last_error)=($1,0,$2,'') WHERE message_id=$3 AND status=$4"
+	_, err := session.Database(ctx).ExecContext(ctx, query, MessageStatusSent, time.Time{}, messageId, MessageStatusFailed)
 	if err != nil {
 		return session.TransactionError(ctx, err)
 	}
@@ -305,8 +425,9 @@ func UpdateMessagesStatus(ctx context.Context, messages []*DistributedMessage) e
 }
 
 func ClearUpExpiredDistributedMessages(ctx context.Context, shards []string) (int64, error) {
-	query := fmt.Sprintf("DELETE FROM distributed_messages WHERE message_id IN (SELECT message_id FROM distributed_messages WHERE shard = ANY($1) AND status=$2 AND created_at<$3 LIMIT 100)")
-	r, err := session.Database(ctx).ExecContext(ctx, query, pq.StringArray(shards), MessageStatusDelivered, time.Now().Add(-72*time.Hour))
+	query := fmt.Sprintf("DELETE FROM distributed_messages WHERE message_id IN (SELECT message_id FROM distributed_messages WHERE shard = ANY($1) AND status = ANY($2) AND created_at<$3 LIMIT 100)")
+	statuses := []string{MessageStatusDelivered, MessageStatusReceived, MessageStatusRead, MessageStatusFailed}
+	r, err := session.Database(ctx).ExecContext(ctx, query, pq.StringArray(shards), pq.StringArray(statuses), time.Now().Add(-72*time.Hour))
 	if err != nil {
 		return 0, session.TransactionError(ctx, err)
 	}
@@ -364,7 +485,11 @@ func distributedMessageValuesString(id, conversationId, recipientId, userId, par
 	return fmt.Sprintf("('%s','%s','%s','%s','%s', '%s','%s','%s','%s','%s', '%s')", id, conversationId, recipientId, userId, parentId, quoteMessageId, shard, category, data, status, string(pq.FormatTimestamp(time.Now())))
 }
 
-func shardId(cid, uid string) (string, error) {
+func shardId(ctx context.Context, cid, uid string) (string, error) {
+	size, err := messageShardSize(ctx)
+	if err != nil {
+		return "", err
+	}
 	minId, maxId := cid, uid
 	if strings.Compare(cid, uid) > 0 {
 		maxId, minId = cid, uid
@@ -373,15 +498,8 @@ func shardId(cid, uid string) (string, error) {
 	io.WriteString(h, minId)
 	io.WriteString(h, maxId)
 
-	b := new(big.Int).SetInt64(config.AppConfig.System.MessageShardSize)
+	b := new(big.Int).SetInt64(size)
 	c := new(big.Int).SetBytes(h.Sum(nil))
 	m := new(big.Int).Mod(c, b)
-	h = md5.New()
-	h.Write([]byte(config.AppConfig.System.MessageShardModifier))
-	h.Write(m.Bytes())
-	s := h.Sum(nil)
-	s[6] = (s[6] & 0x0f) | 0x30
-	s[8] = (s[8] & 0x3f) | 0x80
-	sid, err := uuid.FromBytes(s)
-	return sid.String(), err
+	return messageShardId(m), nil
 }
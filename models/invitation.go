@@ -0,0 +1,258 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	InvitationCodeLength = 8
+	InvitationsLimit     = 100
+
+	invitationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+const invitations_DDL = `
+CREATE TABLE IF NOT EXISTS invitations (
+	code               VARCHAR(32) PRIMARY KEY,
+	creator_id         VARCHAR(36) NOT NULL CHECK (creator_id ~* '^[0-9a-f-]{36,36}$'),
+	plan               VARCHAR(128) NOT NULL DEFAULT '',
+	discount           BIGINT NOT NULL DEFAULT 0,
+	max_uses           BIGINT NOT NULL DEFAULT 1,
+	used_count         BIGINT NOT NULL DEFAULT 0,
+	expired_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitations_creator_createdx ON invitations(creator_id, created_at);
+`
+
+var invitationsCols = []string{"code", "creator_id", "plan", "discount", "max_uses", "used_count", "expired_at", "created_at"}
+
+func (i *Invitation) values() []interface{} {
+	return []interface{}{i.Code, i.CreatorId, i.Plan, i.Discount, i.MaxUses, i.UsedCount, i.ExpiredAt, i.CreatedAt}
+}
+
+func invitationFromRow(row durable.Row) (*Invitation, error) {
+	var i Invitation
+	err := row.Scan(&i.Code, &i.CreatorId, &i.Plan, &i.Discount, &i.MaxUses, &i.UsedCount, &i.ExpiredAt, &i.CreatedAt)
+	return &i, err
+}
+
+// Invitation is an invite code, the discount is a percentage of the join fee
+// and 100 means free membership of the plan. Zero max_uses means unlimited,
+// and the zero expired_at means it never expires.
+type Invitation struct {
+	Code      string
+	CreatorId string
+	Plan      string
+	Discount  int64
+	MaxUses   int64
+	UsedCount int64
+	ExpiredAt time.Time
+	CreatedAt time.Time
+}
+
+func (i *Invitation) available() bool {
+	if !i.ExpiredAt.IsZero() && i.ExpiredAt.Before(time.Now()) {
+		return false
+	}
+	return i.MaxUses == 0 || i.UsedCount < i.MaxUses
+}
+
+// CreateInvitation lets members invite with at most the member_invitation_discount,
+// while those holding the invite permission could create any code.
+func (current *User) CreateInvitation(ctx context.Context, plan string, discount, maxUses int64, expiredAt time.Time) (*Invitation, error) {
+	privileged := current.Can(PermissionInvite)
+	if !privileged && current.State != PaymentStatePaid {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if !privileged && (discount > config.AppConfig.System.MemberInvitationDiscount || maxUses == 0) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if discount < 0 || discount > 100 || maxUses < 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	if _, found := subscriptionPlanDurations[plan]; (discount == 100) != found {
+		return nil, session.BadDataError(ctx)
+	}
+	if !expiredAt.IsZero() && expiredAt.Before(time.Now()) {
+		return nil, session.BadDataError(ctx)
+	}
+	code, err := generateInvitationCode()
+	if err != nil {
+		return nil, session.ServerError(ctx, err)
+	}
+
+	i := &Invitation{
+		Code:      code,
+		CreatorId: current.UserId,
+		Plan:      plan,
+		Discount:  discount,
+		MaxUses:   maxUses,
+		ExpiredAt: expiredAt,
+		CreatedAt: time.Now(),
+	}
+	params, positions := compileTableQuery(invitationsCols)
+	query := fmt.Sprintf("INSERT INTO invitations (%s) VALUES (%s)", params, positions)
+	_, err = session.Database(ctx).ExecContext(ctx, query, i.values()...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return i, nil
+}
+
+func (current *User) ReadInvitations(ctx context.Context) ([]*Invitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM invitations WHERE creator_id=$1 ORDER BY creator_id,created_at DESC LIMIT %d", strings.Join(invitationsCols, ","), InvitationsLimit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, current.UserId)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var invitations []*Invitation
+	for rows.Next() {
+		i, err := invitationFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, nil
+}
+
+func ReadInvitation(ctx context.Context, code string) (*Invitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM invitations WHERE code=$1", strings.Join(invitationsCols, ","))
+	i, err := invitationFromRow(session.Database(ctx).QueryRowContext(ctx, query, normalizeInvitationCode(code)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return i, nil
+}
+
+// RevokeInvitation expires the code, it's still shown to its creator.
+func (current *User) RevokeInvitation(ctx context.Context, code string) error {
+	i, err := ReadInvitation(ctx, code)
+	if err != nil {
+		return err
+	} else if i == nil {
+		return session.NotFoundError(ctx)
+	}
+	if i.CreatorId != current.UserId && !current.Can(PermissionInvite) {
+		return session.ForbiddenError(ctx)
+	}
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE invitations SET expired_at=$1 WHERE code=$2", time.Now(), i.Code)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// RedeemInvitation records the creator of the code as the referrer, a pending
+// user could redeem only once, a free code joins the group at once, and the
+// others take effect when paying.
+func (user *User) RedeemInvitation(ctx context.Context, code string) (*Invitation, error) {
+	if user.State != PaymentStatePending || user.InvitationCode != "" {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var invitation *Invitation
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM invitations WHERE code=$1 FOR UPDATE", strings.Join(invitationsCols, ","))
+		i, err := invitationFromRow(tx.QueryRowContext(ctx, query, normalizeInvitationCode(code)))
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !i.available() || i.CreatorId == user.UserId {
+			return session.ForbiddenError(ctx)
+		}
+		if b, err := readBlacklistInTx(ctx, tx, user.UserId); err != nil {
+			return err
+		} else if b != nil {
+			return session.ForbiddenError(ctx)
+		}
+		invitation = i
+		i.UsedCount++
+		_, err = tx.ExecContext(ctx, "UPDATE invitations SET used_count=$1 WHERE code=$2", i.UsedCount, i.Code)
+		if err != nil {
+			return err
+		}
+		user.InvitationCode, user.ReferrerId = i.Code, i.CreatorId
+		_, err = tx.ExecContext(ctx, "UPDATE users SET (invitation_code,referrer_id)=($1,$2) WHERE user_id=$3", user.InvitationCode, user.ReferrerId, user.UserId)
+		if err != nil || i.Discount < 100 {
+			return err
+		}
+		return user.paymentInTx(ctx, tx, PayMethodInvitation, i.Plan)
+	})
+	if err != nil {
+		if sessionErr, ok := err.(session.Error); ok {
+			return nil, sessionErr
+		}
+		return nil, session.TransactionError(ctx, err)
+	}
+	if invitation == nil {
+		return nil, session.NotFoundError(ctx)
+	}
+	return invitation, nil
+}
+
+// invitationDiscount is the discount of the code redeemed, it only applies to
+// joining, never to renewals. The expired members are pending again but keep
+// the pay method, and those paid have a matched payment.
+func (user *User) invitationDiscount(ctx context.Context) (int64, error) {
+	if user.State != PaymentStatePending || user.InvitationCode == "" || user.PayMethod != "" {
+		return 0, nil
+	}
+	var count int64
+	query := "SELECT COUNT(*) FROM payments WHERE user_id=$1 AND result=$2"
+	err := session.Database(ctx).QueryRowContext(ctx, query, user.UserId, PaymentResultMatched).Scan(&count)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	if count > 0 {
+		return 0, nil
+	}
+	i, err := ReadInvitation(ctx, user.InvitationCode)
+	if err != nil || i == nil {
+		return 0, err
+	}
+	return i.Discount, nil
+}
+
+func discountPrice(amount string, discount int64) number.Decimal {
+	price := number.FromString(amount)
+	if discount > 0 {
+		price = price.Mul(number.FromString(fmt.Sprint(100 - discount))).Div(number.FromString("100"))
+	}
+	return price.RoundFloor(8)
+}
+
+func normalizeInvitationCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func generateInvitationCode() (string, error) {
+	code := make([]byte, InvitationCodeLength)
+	max := big.NewInt(int64(len(invitationCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = invitationCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitationCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "admin", "http://localhost")
+	assert.Nil(err)
+	member, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "member", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+	config.AppConfig.System.MemberInvitationDiscount = 10
+
+	invitation, err := member.CreateInvitation(ctx, "", 0, 1, time.Time{})
+	assert.NotNil(err)
+	assert.Nil(invitation)
+	err = testPayment(ctx, member, SubscriptionPlanLifetime)
+	assert.Nil(err)
+	member, err = FindUser(ctx, member.UserId)
+	assert.Nil(err)
+	invitation, err = member.CreateInvitation(ctx, "", 50, 1, time.Time{})
+	assert.NotNil(err)
+	invitation, err = member.CreateInvitation(ctx, "", 10, 0, time.Time{})
+	assert.NotNil(err)
+	discounted, err := member.CreateInvitation(ctx, "", 10, 1, time.Time{})
+	assert.Nil(err)
+	assert.Len(discounted.Code, InvitationCodeLength)
+
+	invitation, err = admin.CreateInvitation(ctx, "", 100, 1, time.Time{})
+	assert.NotNil(err)
+	invitation, err = admin.CreateInvitation(ctx, SubscriptionPlanMonthly, 50, 1, time.Time{})
+	assert.NotNil(err)
+	invitation, err = admin.CreateInvitation(ctx, "", 0, 1, time.Now().Add(-time.Hour))
+	assert.NotNil(err)
+	free, err := admin.CreateInvitation(ctx, SubscriptionPlanMonthly, 100, 0, time.Now().Add(time.Hour))
+	assert.Nil(err)
+
+	invitations, err := member.ReadInvitations(ctx)
+	assert.Nil(err)
+	assert.Len(invitations, 1)
+	invitation, err = ReadInvitation(ctx, " "+free.Code+" ")
+	assert.Nil(err)
+	assert.NotNil(invitation)
+	invitation, err = ReadInvitation(ctx, "NOTFOUND")
+	assert.Nil(err)
+	assert.Nil(invitation)
+
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "li", "http://localhost")
+	assert.Nil(err)
+	invitation, err = li.RedeemInvitation(ctx, "NOTFOUND")
+	assert.NotNil(err)
+	invitation, err = li.RedeemInvitation(ctx, free.Code)
+	assert.Nil(err)
+	assert.Equal(int64(1), invitation.UsedCount)
+	li, err = FindUser(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, li.State)
+	assert.Equal(PayMethodInvitation, li.PayMethod)
+	assert.Equal(SubscriptionPlanMonthly, li.Plan)
+	assert.Equal(free.Code, li.InvitationCode)
+	assert.Equal(admin.UserId, li.ReferrerId)
+	invitation, err = li.RedeemInvitation(ctx, discounted.Code)
+	assert.NotNil(err)
+
+	wang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1003", "wang", "http://localhost")
+	assert.Nil(err)
+	invitation, err = wang.RedeemInvitation(ctx, discounted.Code)
+	assert.Nil(err)
+	assert.Equal(int64(10), invitation.Discount)
+	zhang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1004", "zhang", "http://localhost")
+	assert.Nil(err)
+	invitation, err = zhang.RedeemInvitation(ctx, discounted.Code)
+	assert.NotNil(err)
+
+	wang, err = FindUser(ctx, wang.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, wang.State)
+	assert.Equal(member.UserId, wang.ReferrerId)
+	err = wang.Payment(ctx, testTransfer(wang, "0.1"))
+	assert.Nil(err)
+	wang, err = FindUser(ctx, wang.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, wang.State)
+	err = wang.Payment(ctx, testTransfer(wang, "0.09"))
+	assert.Nil(err)
+	wang, err = FindUser(ctx, wang.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, wang.State)
+	assert.Equal(SubscriptionPlanLifetime, wang.Plan)
+
+	for _, u := range []*User{wang, li} {
+		_, err = session.Database(ctx).ExecContext(ctx, "UPDATE users SET (state,subscribed_at)=($1,$2) WHERE user_id=$3", PaymentStatePending, time.Time{}, u.UserId)
+		assert.Nil(err)
+		u, err = FindUser(ctx, u.UserId)
+		assert.Nil(err)
+		discount, err := u.invitationDiscount(ctx)
+		assert.Nil(err)
+		assert.Equal(int64(0), discount)
+	}
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE users SET pay_method='' WHERE user_id=$1", wang.UserId)
+	assert.Nil(err)
+	wang, err = FindUser(ctx, wang.UserId)
+	assert.Nil(err)
+	discount, err := wang.invitationDiscount(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), discount)
+
+	err = member.RevokeInvitation(ctx, free.Code)
+	assert.NotNil(err)
+	err = admin.RevokeInvitation(ctx, free.Code)
+	assert.Nil(err)
+	invitation, err = zhang.RedeemInvitation(ctx, free.Code)
+	assert.NotNil(err)
+}
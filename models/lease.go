@@ -0,0 +1,92 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	LeasePrefixInstance = "instance:"
+	LeasePrefixShard    = "shard:"
+	LeaseShardMigration = "shard-migration"
+	LeaseLeader         = "leader"
+)
+
+const leases_DDL = `
+CREATE TABLE IF NOT EXISTS leases (
+	name               VARCHAR(256) PRIMARY KEY,
+	owner_id           VARCHAR(36) NOT NULL,
+	expired_at         TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+`
+
+var leasesCols = []string{"name", "owner_id", "expired_at", "updated_at"}
+
+func leaseFromRow(row durable.Row) (*Lease, error) {
+	var l Lease
+	err := row.Scan(&l.Name, &l.OwnerId, &l.ExpiredAt, &l.UpdatedAt)
+	return &l, err
+}
+
+// Lease is owned by a message service process until it expires, the owner
+// renews it before expiry, and the others take it over only after expiry.
+type Lease struct {
+	Name      string
+	OwnerId   string
+	ExpiredAt time.Time
+	UpdatedAt time.Time
+}
+
+// AcquireLease takes the lease if it's free or expired, or renews it if it's
+// owned already. The expiry is computed by PostgreSQL, so that the clocks of
+// the processes don't matter.
+func AcquireLease(ctx context.Context, name, ownerId string, ttl time.Duration) (bool, error) {
+	query := `INSERT INTO leases (name,owner_id,expired_at,updated_at) VALUES ($1,$2,NOW()+$3*INTERVAL '1 millisecond',NOW())
+		ON CONFLICT (name) DO UPDATE SET (owner_id,expired_at,updated_at)=(EXCLUDED.owner_id,EXCLUDED.expired_at,EXCLUDED.updated_at)
+		WHERE leases.owner_id=EXCLUDED.owner_id OR leases.expired_at<NOW()`
+	r, err := session.Database(ctx).ExecContext(ctx, query, name, ownerId, int64(ttl/time.Millisecond))
+	if err != nil {
+		return false, session.TransactionError(ctx, err)
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return false, session.TransactionError(ctx, err)
+	}
+	return n == 1, nil
+}
+
+func ReleaseLease(ctx context.Context, name, ownerId string) error {
+	query := "DELETE FROM leases WHERE name=$1 AND owner_id=$2"
+	_, err := session.Database(ctx).ExecContext(ctx, query, name, ownerId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// ReadLeases lists the leases not expired by the name prefix, e.g. the live
+// processes by LeasePrefixInstance.
+func ReadLeases(ctx context.Context, prefix string) ([]*Lease, error) {
+	query := fmt.Sprintf("SELECT %s FROM leases WHERE name LIKE $1 AND expired_at>NOW() ORDER BY name", strings.Join(leasesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, prefix+"%")
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var leases []*Lease
+	for rows.Next() {
+		l, err := leaseFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		leases = append(leases, l)
+	}
+	return leases, nil
+}
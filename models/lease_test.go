@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	first, second := bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	name := LeasePrefixShard + bot.UuidNewV4().String()
+	acquired, err := AcquireLease(ctx, name, first, time.Minute)
+	assert.Nil(err)
+	assert.True(acquired)
+	acquired, err = AcquireLease(ctx, name, first, time.Minute)
+	assert.Nil(err)
+	assert.True(acquired)
+	acquired, err = AcquireLease(ctx, name, second, time.Minute)
+	assert.Nil(err)
+	assert.False(acquired)
+	leases, err := ReadLeases(ctx, LeasePrefixShard)
+	assert.Nil(err)
+	assert.Len(leases, 1)
+	assert.Equal(first, leases[0].OwnerId)
+	leases, err = ReadLeases(ctx, LeasePrefixInstance)
+	assert.Nil(err)
+	assert.Len(leases, 0)
+
+	err = ReleaseLease(ctx, name, second)
+	assert.Nil(err)
+	acquired, err = AcquireLease(ctx, name, second, time.Minute)
+	assert.Nil(err)
+	assert.False(acquired)
+	err = ReleaseLease(ctx, name, first)
+	assert.Nil(err)
+	acquired, err = AcquireLease(ctx, name, second, -time.Minute)
+	assert.Nil(err)
+	assert.True(acquired)
+	leases, err = ReadLeases(ctx, LeasePrefixShard)
+	assert.Nil(err)
+	assert.Len(leases, 0)
+	acquired, err = AcquireLease(ctx, name, first, time.Minute)
+	assert.Nil(err)
+	assert.True(acquired)
+}
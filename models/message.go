@@ -20,8 +20,10 @@ import (
 )
 
 const (
-	MessageStatePending = "pending"
-	MessageStateSuccess = "success"
+	MessageStatePending  = "pending"
+	MessageStateSuccess  = "success"
+	MessageStateHeld     = "held"
+	MessageStateApproved = "approved"
 
 	MessageCategoryMessageRecall  = "MESSAGE_RECALL"
 	MessageCategoryPlainText      = "PLAIN_TEXT"
@@ -41,7 +43,9 @@ CREATE TABLE IF NOT EXISTS messages (
 	user_id	              VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
 	category              VARCHAR(512) NOT NULL,
 	quote_message_id      VARCHAR(36) NOT NULL DEFAULT '',
+	thread_id             VARCHAR(36) NOT NULL DEFAULT '',
 	data                  TEXT NOT NULL,
+	search_text           TEXT NOT NULL DEFAULT '',
 	created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	updated_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	state                 VARCHAR(128) NOT NULL,
@@ -49,17 +53,19 @@ CREATE TABLE IF NOT EXISTS messages (
 );
 
 CREATE INDEX IF NOT EXISTS messages_state_updatedx ON messages(state, updated_at);
+CREATE INDEX IF NOT EXISTS messages_thread_createdx ON messages(thread_id, created_at);
+CREATE INDEX IF NOT EXISTS messages_searchx ON messages USING GIN (to_tsvector('simple', search_text));
 `
 
-var messagesCols = []string{"message_id", "user_id", "category", "quote_message_id", "data", "created_at", "updated_at", "state", "last_distribute_at"}
+var messagesCols = []string{"message_id", "user_id", "category", "quote_message_id", "thread_id", "data", "created_at", "updated_at", "state", "last_distribute_at"}
 
 func (m *Message) values() []interface{} {
-	return []interface{}{m.MessageId, m.UserId, m.Category, m.QuoteMessageId, m.Data, m.CreatedAt, m.UpdatedAt, m.State, m.LastDistributeAt}
+	return []interface{}{m.MessageId, m.UserId, m.Category, m.QuoteMessageId, m.ThreadId, m.Data, m.CreatedAt, m.UpdatedAt, m.State, m.LastDistributeAt}
 }
 
 func messageFromRow(row durable.Row) (*Message, error) {
 	var m Message
-	err := row.Scan(&m.MessageId, &m.UserId, &m.Category, &m.QuoteMessageId, &m.Data, &m.CreatedAt, &m.UpdatedAt, &m.State, &m.LastDistributeAt)
+	err := row.Scan(&m.MessageId, &m.UserId, &m.Category, &m.QuoteMessageId, &m.ThreadId, &m.Data, &m.CreatedAt, &m.UpdatedAt, &m.State, &m.LastDistributeAt)
 	return &m, err
 }
 
@@ -68,6 +74,7 @@ type Message struct {
 	UserId           string
 	Category         string
 	QuoteMessageId   string
+	ThreadId         string
 	Data             string
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
@@ -75,6 +82,7 @@ type Message struct {
 	LastDistributeAt time.Time
 
 	FullName sql.NullString
+	Delivery *MessageDelivery
 }
 
 func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMessageId, data string, createdAt, updatedAt time.Time) (*Message, error) {
@@ -82,13 +90,29 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		return nil, nil
 	}
 	// is white list
-	if !user.isWhiteList() && !user.isAdmin() && user.UserId != config.AppConfig.Mixin.ClientId {
+	if !user.isWhiteList() && roleRanks[user.GetRole()] < roleRanks[RoleAdmin] && user.UserId != config.AppConfig.Mixin.ClientId {
 		b, err := ReadProhibitedProperty(ctx)
 		if err != nil {
 			return nil, err
 		} else if b {
 			return nil, nil
 		}
+		if category != MessageCategoryMessageRecall {
+			mute, err := ReadMute(ctx, user.UserId)
+			if err != nil {
+				return nil, err
+			}
+			if mute != nil {
+				text := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(config.AppConfig.MessageTemplate.MessageTipsMuted, mute.ExpiredAt.Format("2006-01-02 15:04 MST"))))
+				err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+					return createSystemDistributedMessage(ctx, tx, user, MessageCategoryPlainText, text)
+				})
+				if err != nil {
+					return nil, err
+				}
+				return nil, nil
+			}
+		}
 		if category == MessageCategoryPlainImage && !config.AppConfig.System.ImageMessageEnable {
 			return nil, nil
 		}
@@ -114,20 +138,41 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		}
 	}
 
-	if user.isAdmin() && category == MessageCategoryPlainText && quoteMessageId != "" {
+	// the reply commands are handled only when the operator holds the permission,
+	// otherwise they are sent as plain replies. BAN and KICK recall the message as
+	// well, the permission of the command covers the recall.
+	var commanded bool
+	if user.IsOperator() && category == MessageCategoryPlainText && quoteMessageId != "" {
 		if id, _ := bot.UuidFromString(quoteMessageId); id.String() == quoteMessageId {
 			bytes, err := base64.StdEncoding.DecodeString(data)
 			if err != nil {
 				return nil, err
 			}
 			str := strings.ToUpper(strings.TrimSpace(string(bytes)))
-			if str == "BAN" || str == "DELETE" || str == "KICK" {
+			// a bad command is answered with a tip, an error would leave the
+			// message unacknowledged and redelivered forever.
+			if strings.HasPrefix(str, "MUTE ") && user.Can(PermissionMute) {
+				duration, err := ParseMuteDuration(strings.TrimPrefix(str, "MUTE "))
+				if err != nil || duration <= 0 || duration > MaximumMuteDuration {
+					return nil, sendMuteUsageTip(ctx, user)
+				}
+				dm, err := FindDistributedMessage(ctx, quoteMessageId)
+				if err != nil || dm == nil {
+					return nil, err
+				}
+				if u, err := FindUser(ctx, dm.UserId); err != nil || u == nil {
+					return nil, err
+				}
+				_, err = user.CreateMute(ctx, dm.UserId, duration)
+				return nil, err
+			}
+			if (str == "BAN" && user.Can(PermissionBan)) || (str == "DELETE" && user.Can(PermissionDeleteMessage)) || (str == "KICK" && user.Can(PermissionKick)) {
 				dm, err := FindDistributedMessage(ctx, quoteMessageId)
 				if err != nil || dm == nil {
 					return nil, err
 				}
 				if str == "BAN" {
-					_, err = user.CreateBlacklist(ctx, dm.UserId)
+					_, err = user.CreateBlacklist(ctx, dm.UserId, fmt.Sprintf("BAN message %s", dm.ParentId))
 					if err != nil {
 						return nil, err
 					}
@@ -138,6 +183,7 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 						return nil, err
 					}
 				}
+				commanded = true
 				quoteMessageId = ""
 				category = MessageCategoryMessageRecall
 				data = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`{"message_id":"%s"}`, dm.ParentId)))
@@ -168,6 +214,21 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 			}
 		}
 	}
+	if message.QuoteMessageId != "" && category != MessageCategoryMessageRecall {
+		parent, err := FindMessage(ctx, message.QuoteMessageId)
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil {
+			message.ThreadId = parent.MessageId
+			if parent.ThreadId != "" {
+				message.ThreadId = parent.ThreadId
+			}
+		}
+	}
+	// an operator recalling someone else's message is a deletion worth auditing,
+	// this covers the BAN, DELETE and KICK reply commands as well.
+	var deletedMessage *Message
 	if category == MessageCategoryMessageRecall {
 		bytes, err := base64.StdEncoding.DecodeString(data)
 		if err != nil {
@@ -182,16 +243,35 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		if err != nil || m == nil {
 			return nil, err
 		}
-		if m.UserId != user.UserId && !user.isAdmin() {
-			return nil, session.ForbiddenError(ctx)
-		}
-		if user.isAdmin() {
+		if m.UserId != user.UserId {
+			if !commanded && !user.Can(PermissionDeleteMessage) {
+				return nil, session.ForbiddenError(ctx)
+			}
 			message.UserId = m.UserId
+			deletedMessage = m
 		}
 	}
 	params, positions := compileTableQuery(messagesCols)
 	query := fmt.Sprintf("INSERT INTO messages (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", params, positions)
-	_, err := session.Database(ctx).ExecContext(ctx, query, message.values()...)
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		r, err := tx.ExecContext(ctx, query, message.values()...)
+		if err != nil {
+			return err
+		}
+		if count, err := r.RowsAffected(); err != nil || count == 0 {
+			return err
+		}
+		if deletedMessage != nil {
+			err = createAuditLogInTx(ctx, tx, user.UserId, AuditActionDeleteMessage, deletedMessage.MessageId, fmt.Sprintf("%s %s", deletedMessage.UserId, deletedMessage.Category))
+			if err != nil {
+				return err
+			}
+		}
+		if message.ThreadId == "" {
+			return nil
+		}
+		return upsertThreadInTx(ctx, tx, message)
+	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
@@ -262,8 +342,8 @@ func createSystemJoinMessage(ctx context.Context, tx *sql.Tx, user *User) error
 
 func PendingMessages(ctx context.Context, limit int64) ([]*Message, error) {
 	var messages []*Message
-	query := fmt.Sprintf("SELECT %s FROM messages WHERE state=$1 ORDER BY state,updated_at LIMIT $2", strings.Join(messagesCols, ","))
-	rows, err := session.Database(ctx).QueryContext(ctx, query, MessageStatePending, limit)
+	query := fmt.Sprintf("SELECT %s FROM messages WHERE state IN ($1,$2) ORDER BY state,updated_at LIMIT $3", strings.Join(messagesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, MessageStatePending, MessageStateApproved, limit)
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
@@ -299,7 +379,7 @@ func FindMessage(ctx context.Context, id string) (*Message, error) {
 }
 
 func LastestMessageWithUser(ctx context.Context, limit int64) ([]*Message, error) {
-	query := "SELECT messages.message_id,messages.category,messages.data,messages.created_at,users.full_name FROM messages LEFT JOIN users ON messages.user_id=users.user_id ORDER BY updated_at DESC LIMIT $1"
+	query := "SELECT messages.message_id,messages.user_id,messages.category,messages.data,messages.created_at,users.full_name FROM messages LEFT JOIN users ON messages.user_id=users.user_id ORDER BY updated_at DESC LIMIT $1"
 	rows, err := session.Database(ctx).QueryContext(ctx, query, limit)
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
@@ -309,18 +389,28 @@ func LastestMessageWithUser(ctx context.Context, limit int64) ([]*Message, error
 	var messages []*Message
 	for rows.Next() {
 		var m Message
-		err := rows.Scan(&m.MessageId, &m.Category, &m.Data, &m.CreatedAt, &m.FullName)
+		err := rows.Scan(&m.MessageId, &m.UserId, &m.Category, &m.Data, &m.CreatedAt, &m.FullName)
 		if err != nil {
 			return nil, session.TransactionError(ctx, err)
 		}
-		if m.Category == MessageCategoryPlainText {
-			data, _ := base64.StdEncoding.DecodeString(m.Data)
-			m.Data = string(data)
-		} else {
-			m.Data = ""
-		}
+		decodeMessagePreview(&m)
 		messages = append(messages, &m)
 	}
+
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.MessageId
+	}
+	deliveries, err := readMessageDeliveries(ctx, ids)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	for _, m := range messages {
+		m.Delivery = deliveries[m.MessageId]
+		if m.Delivery == nil {
+			m.Delivery = &MessageDelivery{}
+		}
+	}
 	return messages, nil
 }
 
@@ -372,3 +462,16 @@ func FirstNStringInRune(s string, n int) string {
 	}
 	return string([]rune(s)[:n]) + "..."
 }
+
+// transferMemo truncates the memo to the 140 bytes limit of the transfers,
+// without breaking a character in the middle.
+func transferMemo(memo string) string {
+	if len(memo) <= 140 {
+		return memo
+	}
+	n := 140
+	for n > 0 && !utf8.RuneStart(memo[n]) {
+		n--
+	}
+	return memo[:n]
+}
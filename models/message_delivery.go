@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/lib/pq"
+)
+
+const (
+	MessageReceiptDelivered = "DELIVERED"
+	MessageReceiptRead      = "READ"
+)
+
+// MessageDelivery counts the distributed messages of a parent message, the
+// queued ones are not posted yet, and the counts include the later states,
+// e.g. a read message is also sent and delivered. The failed ones are the
+// dead letters given up after the last attempt.
+type MessageDelivery struct {
+	Queued    int64
+	Sent      int64
+	Delivered int64
+	Read      int64
+	Failed    int64
+}
+
+// UpdateDistributedMessagesReceipt records a batch of ACKNOWLEDGE_MESSAGE_RECEIPT
+// of the distributed messages, the status only moves forward, a receipt may
+// arrive before the status is updated after posting.
+func UpdateDistributedMessagesReceipt(ctx context.Context, receipt string, messageIds []string) error {
+	var status string
+	var previous []string
+	switch receipt {
+	case MessageReceiptDelivered:
+		status, previous = MessageStatusReceived, []string{MessageStatusSent, MessageStatusDelivered}
+	case MessageReceiptRead:
+		status, previous = MessageStatusRead, []string{MessageStatusSent, MessageStatusDelivered, MessageStatusReceived}
+	default:
+		return nil
+	}
+	if len(messageIds) == 0 {
+		return nil
+	}
+	query := "UPDATE distributed_messages SET status=$1 WHERE message_id=ANY($2) AND status=ANY($3)"
+	_, err := session.Database(ctx).ExecContext(ctx, query, status, pq.StringArray(messageIds), pq.StringArray(previous))
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// readMessageDeliveries aggregates the distributed messages by parent, the
+// delivered ones cleaned up after 72 hours are not counted.
+func readMessageDeliveries(ctx context.Context, parentIds []string) (map[string]*MessageDelivery, error) {
+	deliveries := make(map[string]*MessageDelivery)
+	if len(parentIds) == 0 {
+		return deliveries, nil
+	}
+	query := "SELECT parent_id,status,COUNT(*) FROM distributed_messages WHERE parent_id=ANY($1) GROUP BY parent_id,status"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, pq.StringArray(parentIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var parentId, status string
+		var count int64
+		if err := rows.Scan(&parentId, &status, &count); err != nil {
+			return nil, err
+		}
+		d := deliveries[parentId]
+		if d == nil {
+			d = &MessageDelivery{}
+			deliveries[parentId] = d
+		}
+		switch status {
+		case MessageStatusSent:
+			d.Queued += count
+		case MessageStatusDelivered:
+			d.Sent += count
+		case MessageStatusReceived:
+			d.Sent += count
+			d.Delivered += count
+		case MessageStatusRead:
+			d.Sent += count
+			d.Delivered += count
+			d.Read += count
+		case MessageStatusFailed:
+			d.Failed += count
+		}
+	}
+	return deliveries, nil
+}
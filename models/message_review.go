@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	ReviewDecisionPending = "pending"
+	ReviewDecisionApprove = "approve"
+	ReviewDecisionReject  = "reject"
+	ReviewDecisionBan     = "ban"
+)
+
+const message_reviews_DDL = `
+CREATE TABLE IF NOT EXISTS message_reviews (
+	message_id         VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	reason             VARCHAR(1024) NOT NULL,
+	decision           VARCHAR(128) NOT NULL,
+	reviewer_id        VARCHAR(36) NOT NULL DEFAULT '',
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS message_reviews_decision_createdx ON message_reviews(decision, created_at);
+`
+
+var messageReviewsCols = []string{"message_id", "user_id", "reason", "decision", "reviewer_id", "created_at", "updated_at"}
+
+func (r *MessageReview) values() []interface{} {
+	return []interface{}{r.MessageId, r.UserId, r.Reason, r.Decision, r.ReviewerId, r.CreatedAt, r.UpdatedAt}
+}
+
+func messageReviewFromRow(row durable.Row) (*MessageReview, error) {
+	var r MessageReview
+	err := row.Scan(&r.MessageId, &r.UserId, &r.Reason, &r.Decision, &r.ReviewerId, &r.CreatedAt, &r.UpdatedAt)
+	return &r, err
+}
+
+type MessageReview struct {
+	MessageId  string
+	UserId     string
+	Reason     string
+	Decision   string
+	ReviewerId string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	Message *Message
+}
+
+func createMessageReview(ctx context.Context, tx *sql.Tx, message *Message, reason string) error {
+	t := time.Now()
+	r := &MessageReview{
+		MessageId: message.MessageId,
+		UserId:    message.UserId,
+		Reason:    FirstNStringInRune(reason, 1000),
+		Decision:  ReviewDecisionPending,
+		CreatedAt: t,
+		UpdatedAt: t,
+	}
+	params, positions := compileTableQuery(messageReviewsCols)
+	query := fmt.Sprintf("INSERT INTO message_reviews (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", params, positions)
+	_, err := tx.ExecContext(ctx, query, r.values()...)
+	return err
+}
+
+// ReviewMessage settles a held message, approve puts it back to the pending
+// loop without moderation, reject drops it and ban also blacklists the sender.
+func (current *User) ReviewMessage(ctx context.Context, messageId, decision string) (*MessageReview, error) {
+	if !current.Can(PermissionReview) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	switch decision {
+	case ReviewDecisionApprove, ReviewDecisionReject, ReviewDecisionBan:
+	default:
+		return nil, session.BadDataError(ctx)
+	}
+	if decision == ReviewDecisionBan && !current.Can(PermissionBan) {
+		return nil, session.ForbiddenError(ctx)
+	}
+
+	var review *MessageReview
+	var decided bool
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM message_reviews WHERE message_id=$1 FOR UPDATE", strings.Join(messageReviewsCols, ","))
+		r, err := messageReviewFromRow(tx.QueryRowContext(ctx, query, messageId))
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		review = r
+		if r.Decision != ReviewDecisionPending {
+			return nil
+		}
+		state := MessageStateSuccess
+		if decision == ReviewDecisionApprove {
+			state = MessageStateApproved
+		}
+		r.Decision = decision
+		r.ReviewerId = current.UserId
+		r.UpdatedAt = time.Now()
+		_, err = tx.ExecContext(ctx, "UPDATE message_reviews SET (decision,reviewer_id,updated_at)=($1,$2,$3) WHERE message_id=$4", r.Decision, r.ReviewerId, r.UpdatedAt, r.MessageId)
+		if err != nil {
+			return err
+		}
+		// the message held was copied to the operators with last_distribute_at
+		// moved forward, an approved one is distributed from the start again.
+		query = "UPDATE messages SET (state,updated_at)=($1,$2) WHERE message_id=$3 AND state=$4"
+		args := []interface{}{state, r.UpdatedAt, r.MessageId, MessageStateHeld}
+		if decision == ReviewDecisionApprove {
+			query = "UPDATE messages SET (state,updated_at,last_distribute_at)=($1,$2,$5) WHERE message_id=$3 AND state=$4"
+			args = append(args, genesisStartedAt())
+		}
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		decided = true
+		return createAuditLogInTx(ctx, tx, current.UserId, AuditActionReview, r.MessageId, r.Decision)
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	if !decided || review.Decision != ReviewDecisionBan {
+		return review, nil
+	}
+	_, err = current.CreateBlacklist(ctx, review.UserId, review.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func ReadMessageReviews(ctx context.Context, decision string, offset time.Time, limit int) ([]*MessageReview, error) {
+	if offset.IsZero() {
+		offset = time.Now()
+	}
+	cols := make([]string, len(messageReviewsCols))
+	for i, c := range messageReviewsCols {
+		cols[i] = "message_reviews." + c
+	}
+	query := fmt.Sprintf("SELECT %s,messages.category,messages.data,users.full_name FROM message_reviews LEFT JOIN messages ON message_reviews.message_id=messages.message_id LEFT JOIN users ON message_reviews.user_id=users.user_id WHERE message_reviews.decision=$1 AND message_reviews.created_at<$2 ORDER BY message_reviews.created_at DESC LIMIT $3", strings.Join(cols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, decision, offset, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var reviews []*MessageReview
+	for rows.Next() {
+		var r MessageReview
+		var category, data sql.NullString
+		var m Message
+		err := rows.Scan(&r.MessageId, &r.UserId, &r.Reason, &r.Decision, &r.ReviewerId, &r.CreatedAt, &r.UpdatedAt, &category, &data, &m.FullName)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		m.MessageId, m.UserId, m.Category, m.Data, m.CreatedAt = r.MessageId, r.UserId, category.String, data.String, r.CreatedAt
+		decodeMessagePreview(&m)
+		r.Message = &m
+		reviews = append(reviews, &r)
+	}
+	return reviews, nil
+}
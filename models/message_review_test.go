@@ -0,0 +1,104 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageReviewCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "admin", "http://localhost")
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	wang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "Wang", "http://localhost")
+	assert.Nil(err)
+	zhang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1003", "Zhang", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+	_, err = admin.GrantRole(ctx, zhang.UserId, RoleModerator, nil)
+	assert.Nil(err)
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	err = message.Hold(ctx, "Message contains link")
+	assert.Nil(err)
+	message, err = FindMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStateHeld, message.State)
+	messages, err := PendingMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(messages, 0)
+	var count int64
+	query := "SELECT COUNT(*) FROM distributed_messages WHERE parent_id=$1 AND recipient_id=$2"
+	err = session.Database(ctx).QueryRowContext(ctx, query, message.MessageId, zhang.UserId).Scan(&count)
+	assert.Nil(err)
+	assert.Equal(int64(2), count)
+	err = session.Database(ctx).QueryRowContext(ctx, query, message.MessageId, wang.UserId).Scan(&count)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	reviews, err := ReadMessageReviews(ctx, ReviewDecisionPending, time.Time{}, 10)
+	assert.Nil(err)
+	assert.Len(reviews, 1)
+	assert.Equal("hello", reviews[0].Message.Data)
+	assert.Equal("Message contains link", reviews[0].Reason)
+
+	review, err := li.ReviewMessage(ctx, message.MessageId, ReviewDecisionApprove)
+	assert.NotNil(err)
+	assert.Nil(review)
+	review, err = admin.ReviewMessage(ctx, message.MessageId, "unknown")
+	assert.NotNil(err)
+	review, err = admin.ReviewMessage(ctx, message.MessageId, ReviewDecisionApprove)
+	assert.Nil(err)
+	assert.Equal(ReviewDecisionApprove, review.Decision)
+	assert.Equal(admin.UserId, review.ReviewerId)
+	messages, err = PendingMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.Equal(MessageStateApproved, messages[0].State)
+	assert.True(messages[0].LastDistributeAt.Before(wang.SubscribedAt))
+	err = messages[0].Distribute(ctx)
+	assert.Nil(err)
+	err = session.Database(ctx).QueryRowContext(ctx, query, message.MessageId, wang.UserId).Scan(&count)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	message, err = FindMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStateSuccess, message.State)
+	review, err = admin.ReviewMessage(ctx, message.MessageId, ReviewDecisionReject)
+	assert.Nil(err)
+	assert.Equal(ReviewDecisionApprove, review.Decision)
+
+	message, err = CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	err = message.Hold(ctx, "spam")
+	assert.Nil(err)
+	review, err = admin.ReviewMessage(ctx, message.MessageId, ReviewDecisionBan)
+	assert.Nil(err)
+	assert.Equal(ReviewDecisionBan, review.Decision)
+	message, err = FindMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStateSuccess, message.State)
+	b, err := ReadBlacklist(ctx, li.UserId)
+	assert.Nil(err)
+	assert.NotNil(b)
+	reviews, err = ReadMessageReviews(ctx, ReviewDecisionPending, time.Time{}, 10)
+	assert.Nil(err)
+	assert.Len(reviews, 0)
+
+	review, err = admin.ReviewMessage(ctx, bot.UuidNewV4().String(), ReviewDecisionReject)
+	assert.Nil(err)
+	assert.Nil(review)
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	MessageSearchLimit = 100
+	messageSearchTerms = 5
+)
+
+type MessageSearch struct {
+	Query    string
+	UserId   string
+	Category string
+	Since    time.Time
+	Until    time.Time
+	Cursor   string
+	Limit    int
+}
+
+// SearchMessages only looks into messages that have been distributed to the
+// group, the search_text is filled by Distribute and cleared on recall, so
+// leapfrogged and recalled messages never show up. Only the paid members and
+// the operators could search.
+func (current *User) SearchMessages(ctx context.Context, s *MessageSearch) ([]*Message, string, error) {
+	if current.State != PaymentStatePaid && !current.IsOperator() {
+		return nil, "", session.ForbiddenError(ctx)
+	}
+	terms := strings.Fields(s.Query)
+	if len(terms) == 0 || len(terms) > messageSearchTerms {
+		return nil, "", session.BadDataError(ctx)
+	}
+	if s.Limit <= 0 || s.Limit > MessageSearchLimit {
+		s.Limit = MessageSearchLimit
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	for _, t := range terms {
+		conditions = append(conditions, fmt.Sprintf("to_tsvector('simple', messages.search_text) @@ phraseto_tsquery('simple', %s)", arg(messageSearchText(t))))
+	}
+	if s.UserId != "" {
+		conditions = append(conditions, "messages.user_id="+arg(s.UserId))
+	}
+	if s.Category != "" {
+		conditions = append(conditions, "messages.category="+arg(s.Category))
+	}
+	if !s.Since.IsZero() {
+		conditions = append(conditions, "messages.created_at>="+arg(s.Since))
+	}
+	if !s.Until.IsZero() {
+		conditions = append(conditions, "messages.created_at<"+arg(s.Until))
+	}
+	if s.Cursor != "" {
+		createdAt, messageId, err := parseMessageSearchCursor(s.Cursor)
+		if err != nil {
+			return nil, "", session.BadDataError(ctx)
+		}
+		conditions = append(conditions, fmt.Sprintf("(messages.created_at,messages.message_id)<(%s,%s)", arg(createdAt), arg(messageId)))
+	}
+
+	query := fmt.Sprintf("SELECT messages.message_id,messages.user_id,messages.category,messages.quote_message_id,messages.thread_id,messages.data,messages.created_at,users.full_name FROM messages LEFT JOIN users ON messages.user_id=users.user_id WHERE %s ORDER BY messages.created_at DESC,messages.message_id DESC LIMIT %d", strings.Join(conditions, " AND "), s.Limit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(&m.MessageId, &m.UserId, &m.Category, &m.QuoteMessageId, &m.ThreadId, &m.Data, &m.CreatedAt, &m.FullName)
+		if err != nil {
+			return nil, "", session.TransactionError(ctx, err)
+		}
+		decodeMessagePreview(&m)
+		messages = append(messages, &m)
+	}
+	var next string
+	if len(messages) == s.Limit {
+		last := messages[len(messages)-1]
+		next = buildMessageSearchCursor(last.CreatedAt, last.MessageId)
+	}
+	return messages, next, nil
+}
+
+// messageSearchText puts spaces around CJK characters, the simple text search
+// configuration splits on them so every character becomes a lexeme, and a
+// phrase query matches consecutive characters.
+func messageSearchText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			b.WriteRune(' ')
+			b.WriteRune(r)
+			b.WriteRune(' ')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func messageSearchTextFromData(category, data string) string {
+	if category != MessageCategoryPlainText {
+		return ""
+	}
+	text, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return ""
+	}
+	return messageSearchText(string(text))
+}
+
+func buildMessageSearchCursor(createdAt time.Time, messageId string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "," + messageId))
+}
+
+func parseMessageSearchCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	parts := strings.SplitN(string(data), ",", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", fmt.Errorf("invalid cursor %s", cursor)
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	return createdAt, parts[1], err
+}
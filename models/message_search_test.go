@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchMessages(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	wang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "Wang", "http://localhost")
+	assert.Nil(err)
+
+	texts := []string{"Hello Mixin Network", "今天比特币涨了", "hello world"}
+	for i, text := range texts {
+		user := li
+		if i == 2 {
+			user = wang
+		}
+		data := base64.StdEncoding.EncodeToString([]byte(text))
+		message, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+		assert.Nil(err)
+		assert.NotNil(message)
+		messages, _, err := li.SearchMessages(ctx, &MessageSearch{Query: "hello"})
+		assert.Nil(err)
+		assert.Len(messages, 0)
+		err = message.Distribute(ctx)
+		assert.Nil(err)
+	}
+
+	messages, next, err := li.SearchMessages(ctx, &MessageSearch{Query: "HELLO"})
+	assert.Nil(err)
+	assert.Len(messages, 2)
+	assert.Equal("hello world", messages[0].Data)
+	assert.Equal("", next)
+	messages, _, err = li.SearchMessages(ctx, &MessageSearch{Query: "hello", UserId: li.UserId})
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	messages, _, err = li.SearchMessages(ctx, &MessageSearch{Query: "比特币"})
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	messages, _, err = li.SearchMessages(ctx, &MessageSearch{Query: "比币"})
+	assert.Nil(err)
+	assert.Len(messages, 0)
+	messages, _, err = li.SearchMessages(ctx, &MessageSearch{Query: "hello", Category: MessageCategoryPlainImage})
+	assert.Nil(err)
+	assert.Len(messages, 0)
+	messages, _, err = li.SearchMessages(ctx, &MessageSearch{Query: "hello", Since: time.Now()})
+	assert.Nil(err)
+	assert.Len(messages, 0)
+
+	messages, next, err = li.SearchMessages(ctx, &MessageSearch{Query: "hello", Limit: 1})
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.NotEqual("", next)
+	first := messages[0].MessageId
+	messages, _, err = li.SearchMessages(ctx, &MessageSearch{Query: "hello", Limit: 1, Cursor: next})
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.NotEqual(first, messages[0].MessageId)
+
+	zhang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1003", "Zhang", "http://localhost")
+	assert.Nil(err)
+	zhang.State = PaymentStatePending
+	messages, _, err = zhang.SearchMessages(ctx, &MessageSearch{Query: "hello"})
+	assert.NotNil(err)
+	assert.Nil(messages)
+
+	_, _, err = li.SearchMessages(ctx, &MessageSearch{Query: " "})
+	assert.NotNil(err)
+	_, _, err = li.SearchMessages(ctx, &MessageSearch{Query: "hello", Cursor: "invalid"})
+	assert.NotNil(err)
+}
+
+func TestMessageSearchText(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("hello  你  好 ", messageSearchText("hello 你好"))
+	assert.Equal("", messageSearchTextFromData(MessageCategoryPlainImage, "aGVsbG8="))
+	assert.Equal("hello", messageSearchTextFromData(MessageCategoryPlainText, "aGVsbG8="))
+
+	at := time.Now()
+	id := bot.UuidNewV4().String()
+	createdAt, messageId, err := parseMessageSearchCursor(buildMessageSearchCursor(at, id))
+	assert.Nil(err)
+	assert.True(at.Equal(createdAt))
+	assert.Equal(id, messageId)
+}
@@ -93,8 +93,24 @@ func TestMessageCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.Len(messages, 0)
 
+	err = UpdateDistributedMessagesReceipt(ctx, MessageReceiptRead, []string{dms[0].MessageId})
+	assert.Nil(err)
+	err = UpdateDistributedMessagesReceipt(ctx, MessageReceiptDelivered, []string{dms[0].MessageId})
+	assert.Nil(err)
+	deliveries, err := readMessageDeliveries(ctx, []string{dms[0].ParentId})
+	assert.Nil(err)
+	delivery := deliveries[dms[0].ParentId]
+	assert.NotNil(delivery)
+	assert.Equal(int64(1), delivery.Sent)
+	assert.Equal(int64(1), delivery.Delivered)
+	assert.Equal(int64(1), delivery.Read)
 	err = UpdateMessagesStatus(ctx, dms)
 	assert.Nil(err)
+	deliveries, err = readMessageDeliveries(ctx, []string{dms[0].ParentId})
+	assert.Nil(err)
+	delivery = deliveries[dms[0].ParentId]
+	assert.Equal(int64(0), delivery.Queued)
+	assert.Equal(int64(1), delivery.Read)
 	count, err := testCleanUpExpiredDistributedMessages(ctx)
 	assert.Nil(err)
 	assert.Equal(0, count)
@@ -117,12 +133,55 @@ func TestMessageCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.Len(dms, 4)
 
+	dms[0].LastError = "Forbidden"
+	err = UpdateMessagesFailure(ctx, dms[:1])
+	assert.Nil(err)
+	pending, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(pending, 3)
+	var attempts int64
+	var nextAt time.Time
+	query = "SELECT attempts,next_at FROM distributed_messages WHERE message_id=$1"
+	err = session.Database(ctx).QueryRowContext(ctx, query, dms[0].MessageId).Scan(&attempts, &nextAt)
+	assert.Nil(err)
+	assert.Equal(int64(1), attempts)
+	assert.True(nextAt.After(time.Now().Add(DistributedMessageRetryBase - time.Second)))
+	for i := 1; i < DistributedMessageMaxAttempts; i++ {
+		err = UpdateMessagesFailure(ctx, dms[:1])
+		assert.Nil(err)
+	}
+	admin := &User{UserId: bot.UuidNewV4().String()}
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+	failed, err := user.FailedDistributedMessages(ctx, time.Time{})
+	assert.NotNil(err)
+	assert.Nil(failed)
+	err = user.RetryDistributedMessage(ctx, dms[0].MessageId)
+	assert.NotNil(err)
+	failed, err = admin.FailedDistributedMessages(ctx, time.Time{})
+	assert.Nil(err)
+	assert.Len(failed, 1)
+	assert.Equal(dms[0].MessageId, failed[0].MessageId)
+	assert.Equal(int64(DistributedMessageMaxAttempts), failed[0].Attempts)
+	assert.Equal("Forbidden", failed[0].LastError)
+	deliveries, err = readMessageDeliveries(ctx, []string{dms[0].ParentId})
+	assert.Nil(err)
+	assert.Equal(int64(1), deliveries[dms[0].ParentId].Failed)
+	err = admin.RetryDistributedMessage(ctx, dms[0].MessageId)
+	assert.Nil(err)
+	pending, err = testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(pending, 4)
+	failed, err = admin.FailedDistributedMessages(ctx, time.Time{})
+	assert.Nil(err)
+	assert.Len(failed, 0)
+
 	messages, err = readLastestMessages(ctx, 10)
 	assert.Nil(err)
 	assert.Len(messages, 2)
 	messages, err = LastestMessageWithUser(ctx, 10)
 	assert.Nil(err)
 	assert.Len(messages, 2)
+	assert.NotNil(messages[0].Delivery)
 }
 
 func testReadMessage(ctx context.Context, id string) (*Message, error) {
@@ -149,7 +208,7 @@ func testCleanUpExpiredDistributedMessages(ctx context.Context) (int, error) {
 	count := 0
 	for i := int64(0); i < config.AppConfig.System.MessageShardSize; i++ {
 		shard := testShardId(config.AppConfig.System.MessageShardModifier, i)
-		n, err := CleanUpExpiredDistributedMessages(ctx, shard)
+		n, err := ClearUpExpiredDistributedMessages(ctx, []string{shard})
 		if err != nil {
 			return 0, err
 		}
@@ -171,3 +230,14 @@ func testShardId(modifier string, i int64) string {
 	}
 	return id.String()
 }
+
+func TestTransferMemo(t *testing.T) {
+	assert := assert.New(t)
+
+	memo := strings.Repeat("a", 141)
+	assert.Equal(memo[:140], transferMemo(memo))
+	assert.Equal("hello", transferMemo("hello"))
+	memo = strings.Repeat("中", 50)
+	assert.Equal(strings.Repeat("中", 46), transferMemo(memo))
+	assert.True(len(transferMemo("a"+memo)) <= 140)
+}
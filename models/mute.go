@@ -0,0 +1,157 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const MaximumMuteDuration = 365 * 24 * time.Hour
+
+const mutes_DDL = `
+CREATE TABLE IF NOT EXISTS mutes (
+	user_id            VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	operator_id        VARCHAR(36) NOT NULL CHECK (operator_id ~* '^[0-9a-f-]{36,36}$'),
+	expired_at         TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mutes_expiredx ON mutes(expired_at);
+`
+
+var mutesCols = []string{"user_id", "operator_id", "expired_at", "created_at"}
+
+func (m *Mute) values() []interface{} {
+	return []interface{}{m.UserId, m.OperatorId, m.ExpiredAt, m.CreatedAt}
+}
+
+func muteFromRow(row durable.Row) (*Mute, error) {
+	var m Mute
+	err := row.Scan(&m.UserId, &m.OperatorId, &m.ExpiredAt, &m.CreatedAt)
+	return &m, err
+}
+
+type Mute struct {
+	UserId     string
+	OperatorId string
+	ExpiredAt  time.Time
+	CreatedAt  time.Time
+}
+
+func (user *User) CreateMute(ctx context.Context, userId string, duration time.Duration) (*Mute, error) {
+	_, err := bot.UuidFromString(userId)
+	if err != nil {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if !user.Can(PermissionMute) {
+		return nil, nil
+	}
+	if isOperatorRole(UserRole(userId)) {
+		return nil, nil
+	}
+	if duration <= 0 || duration > MaximumMuteDuration {
+		return nil, session.BadDataError(ctx)
+	}
+
+	t := time.Now()
+	m := &Mute{
+		UserId:     userId,
+		OperatorId: user.UserId,
+		ExpiredAt:  t.Add(duration),
+		CreatedAt:  t,
+	}
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		u, err := findUserById(ctx, tx, userId)
+		if err != nil {
+			return err
+		} else if u == nil {
+			return session.NotFoundError(ctx)
+		}
+		data := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("Muted %s, ID: %d, until %s", u.FullName, u.IdentityNumber, m.ExpiredAt.Format(time.RFC3339))))
+		err = createSystemDistributedMessage(ctx, tx, user, MessageCategoryPlainText, data)
+		if err != nil {
+			return err
+		}
+		params, positions := compileTableQuery(mutesCols)
+		query := fmt.Sprintf("INSERT INTO mutes (%s) VALUES (%s) ON CONFLICT (user_id) DO UPDATE SET (operator_id,expired_at,created_at)=(EXCLUDED.operator_id,EXCLUDED.expired_at,EXCLUDED.created_at)", params, positions)
+		_, err = tx.ExecContext(ctx, query, m.values()...)
+		if err != nil {
+			return err
+		}
+		return createAuditLogInTx(ctx, tx, user.UserId, AuditActionMute, u.UserId, fmt.Sprintf("%s until %s", duration, m.ExpiredAt.Format(time.RFC3339)))
+	})
+	if err != nil {
+		if sessionErr, ok := err.(session.Error); ok {
+			return nil, sessionErr
+		}
+		return nil, session.TransactionError(ctx, err)
+	}
+	return m, nil
+}
+
+func sendMuteUsageTip(ctx context.Context, user *User) error {
+	data := base64.StdEncoding.EncodeToString([]byte("Invalid mute duration, e.g. MUTE 30m, MUTE 2h or MUTE 3d, at most 365d"))
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		return createSystemDistributedMessage(ctx, tx, user, MessageCategoryPlainText, data)
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (user *User) DeleteMute(ctx context.Context, userId string) error {
+	if !user.Can(PermissionMute) {
+		return nil
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		r, err := tx.ExecContext(ctx, "DELETE FROM mutes WHERE user_id=$1", userId)
+		if err != nil {
+			return err
+		}
+		if count, err := r.RowsAffected(); err != nil || count == 0 {
+			return err
+		}
+		return createAuditLogInTx(ctx, tx, user.UserId, AuditActionUnmute, userId, "")
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// ReadMute returns the mute only while it's still in effect.
+func ReadMute(ctx context.Context, userId string) (*Mute, error) {
+	query := fmt.Sprintf("SELECT %s FROM mutes WHERE user_id=$1 AND expired_at>$2", strings.Join(mutesCols, ","))
+	m, err := muteFromRow(session.Database(ctx).QueryRowContext(ctx, query, userId, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return m, nil
+}
+
+// ParseMuteDuration accepts Go durations like 30m or 2h, and days like 3d.
+func ParseMuteDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseInt(strings.TrimSuffix(s, "d"), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if days > int64(MaximumMuteDuration/(24*time.Hour)) {
+			return 0, fmt.Errorf("mute duration %s too long", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
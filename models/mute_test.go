@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuteCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "admin", "http://localhost")
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+
+	mute, err := li.CreateMute(ctx, admin.UserId, time.Hour)
+	assert.Nil(err)
+	assert.Nil(mute)
+	mute, err = admin.CreateMute(ctx, li.UserId, 0)
+	assert.NotNil(err)
+	mute, err = admin.CreateMute(ctx, bot.UuidNewV4().String(), time.Hour)
+	assert.NotNil(err)
+	assert.Nil(mute)
+	for _, text := range []string{"MUTE foo", "MUTE 400d", "MUTE -1d"} {
+		command := base64.StdEncoding.EncodeToString([]byte(text))
+		message, err := CreateMessage(ctx, admin, bot.UuidNewV4().String(), MessageCategoryPlainText, bot.UuidNewV4().String(), command, time.Now(), time.Now())
+		assert.Nil(err)
+		assert.Nil(message)
+	}
+	mute, err = ReadMute(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Nil(mute)
+	mute, err = admin.CreateMute(ctx, li.UserId, time.Hour)
+	assert.Nil(err)
+	assert.NotNil(mute)
+	assert.Equal(admin.UserId, mute.OperatorId)
+	mute, err = ReadMute(ctx, li.UserId)
+	assert.Nil(err)
+	assert.NotNil(mute)
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.Nil(message)
+
+	err = admin.DeleteMute(ctx, li.UserId)
+	assert.Nil(err)
+	mute, err = ReadMute(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Nil(mute)
+	message, err = CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+}
+
+func TestParseMuteDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := ParseMuteDuration("30m")
+	assert.Nil(err)
+	assert.Equal(30*time.Minute, d)
+	d, err = ParseMuteDuration(" 2H ")
+	assert.Nil(err)
+	assert.Equal(2*time.Hour, d)
+	d, err = ParseMuteDuration("3d")
+	assert.Nil(err)
+	assert.Equal(72*time.Hour, d)
+	_, err = ParseMuteDuration("forever")
+	assert.NotNil(err)
+	_, err = ParseMuteDuration("99999999999d")
+	assert.NotNil(err)
+}
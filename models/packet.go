@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
@@ -28,6 +29,12 @@ const (
 	PacketStateExpired  = "EXPIRED"
 	PacketStateRefunded = "REFUNDED"
 
+	PacketTypeLucky = "lucky"
+	PacketTypeEqual = "equal"
+
+	PacketDefaultExpiry = 24
+	PacketRefundDelay   = time.Hour
+
 	shareShardId = "c94ac88f-4671-3976-b60a-09064f1811e8"
 )
 
@@ -42,16 +49,80 @@ CREATE TABLE IF NOT EXISTS packets (
 	remaining_count   BIGINT NOT NULL,
 	remaining_amount  VARCHAR(128) NOT NULL,
 	state             VARCHAR(36) NOT NULL,
-	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	type              VARCHAR(36) NOT NULL DEFAULT 'lucky',
+	rules             TEXT NOT NULL DEFAULT '{}',
+	expired_at        TIMESTAMP WITH TIME ZONE NOT NULL
 );
 
 CREATE INDEX IF NOT EXISTS packets_state_createdx ON packets(state, created_at);
+CREATE INDEX IF NOT EXISTS packets_state_expiredx ON packets(state, expired_at);
+CREATE INDEX IF NOT EXISTS packets_user_createdx ON packets(user_id, created_at);
 `
 
-var packetsCols = []string{"packet_id", "user_id", "asset_id", "amount", "greeting", "total_count", "remaining_count", "remaining_amount", "state", "created_at"}
+var packetsCols = []string{"packet_id", "user_id", "asset_id", "amount", "greeting", "total_count", "remaining_count", "remaining_amount", "state", "created_at", "type", "rules", "expired_at"}
 
 func (p *Packet) values() []interface{} {
-	return []interface{}{p.PacketId, p.UserId, p.AssetId, p.Amount, p.Greeting, p.TotalCount, p.RemainingCount, p.RemainingAmount, p.State, p.CreatedAt}
+	return []interface{}{p.PacketId, p.UserId, p.AssetId, p.Amount, p.Greeting, p.TotalCount, p.RemainingCount, p.RemainingAmount, p.State, p.CreatedAt, p.Type, p.Rules.String(), p.ExpiredAt}
+}
+
+// PacketRules restricts who could claim the packet, a claimer must meet all
+// the rules set, and the zero rules let any paid member claim.
+type PacketRules struct {
+	UserIds      []string  `json:"user_ids"`
+	JoinedBefore time.Time `json:"joined_before"`
+	ActiveDays   int64     `json:"active_days"`
+}
+
+func (r PacketRules) String() string {
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+func (r *PacketRules) normalize() bool {
+	if r.ActiveDays < 0 {
+		return false
+	}
+	filter := make(map[string]bool)
+	var ids []string
+	for _, id := range r.UserIds {
+		uid, err := bot.UuidFromString(id)
+		if err != nil {
+			return false
+		}
+		if filter[uid.String()] {
+			continue
+		}
+		filter[uid.String()] = true
+		ids = append(ids, uid.String())
+	}
+	r.UserIds = ids
+	return true
+}
+
+// eligible takes subscribed_at as the time the user joined, it's set when paid.
+func (r PacketRules) eligible(user *User) bool {
+	if len(r.UserIds) > 0 {
+		found := false
+		for _, id := range r.UserIds {
+			if id == user.UserId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !r.JoinedBefore.IsZero() {
+		if !user.SubscribedAt.After(genesisStartedAt()) || !user.SubscribedAt.Before(r.JoinedBefore) {
+			return false
+		}
+	}
+	if r.ActiveDays > 0 && user.ActiveAt.Before(time.Now().Add(-time.Duration(r.ActiveDays)*24*time.Hour)) {
+		return false
+	}
+	return true
 }
 
 type Packet struct {
@@ -65,6 +136,9 @@ type Packet struct {
 	RemainingAmount string
 	State           string
 	CreatedAt       time.Time
+	Type            string
+	Rules           PacketRules
+	ExpiredAt       time.Time
 
 	User         *User
 	Asset        *Asset
@@ -76,8 +150,8 @@ func (current *User) Prepare(ctx context.Context) (int64, error) {
 	return sum, err
 }
 
-func (current *User) CreatePacket(ctx context.Context, assetId string, amount number.Decimal, totalCount int64, greeting string) (*Packet, error) {
-	if !current.isAdmin() {
+func (current *User) CreatePacket(ctx context.Context, assetId string, amount number.Decimal, totalCount int64, greeting, packetType string, rules PacketRules, expiry int64) (*Packet, error) {
+	if roleRanks[current.GetRole()] < roleRanks[RoleAdmin] {
 		b, err := ReadProhibitedProperty(ctx)
 		if err != nil {
 			return nil, err
@@ -114,10 +188,48 @@ func (current *User) CreatePacket(ctx context.Context, assetId string, amount nu
 			}
 		}
 	}
-	return current.createPacket(ctx, asset, amount, totalCount, greeting)
+	return current.createPacket(ctx, asset, amount, totalCount, greeting, packetType, rules, expiry)
 }
 
-func (current *User) createPacket(ctx context.Context, asset *Asset, amount number.Decimal, totalCount int64, greeting string) (*Packet, error) {
+// PacketExpiryBounds reads the minimum_packet_expiry and maximum_packet_expiry
+// in hours, the packet expires in 24 hours by default.
+func PacketExpiryBounds() (int64, int64) {
+	min, max := config.AppConfig.System.MinimumPacketExpiry, config.AppConfig.System.MaximumPacketExpiry
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = PacketDefaultExpiry
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// createPacket splits the amount randomly for lucky packets, and evenly for
+// equal packets, whose remainder after rounding goes to the last claimer. The
+// packet restricted to a list of users could not have more shares than users.
+// The zero expiry takes the default 24 hours within the bounds.
+func (current *User) createPacket(ctx context.Context, asset *Asset, amount number.Decimal, totalCount int64, greeting, packetType string, rules PacketRules, expiry int64) (*Packet, error) {
+	if packetType == "" {
+		packetType = PacketTypeLucky
+	}
+	if packetType != PacketTypeLucky && packetType != PacketTypeEqual {
+		return nil, session.BadDataError(ctx)
+	}
+	min, max := PacketExpiryBounds()
+	if expiry == 0 {
+		expiry = PacketDefaultExpiry
+		if expiry < min {
+			expiry = min
+		} else if expiry > max {
+			expiry = max
+		}
+	}
+	if expiry < min || expiry > max {
+		return nil, session.BadDataError(ctx)
+	}
 	if amount.Cmp(number.FromString("0.0001")) < 0 {
 		return nil, session.BadDataError(ctx)
 	}
@@ -145,6 +257,16 @@ func (current *User) createPacket(ctx context.Context, asset *Asset, amount numb
 	if totalCount <= 0 || totalCount > int64(participantsCount) {
 		return nil, session.BadDataError(ctx)
 	}
+	if packetType == PacketTypeEqual && equalPacketShare(amount, totalCount).Exhausted() {
+		return nil, session.BadDataError(ctx)
+	}
+	if !rules.normalize() {
+		return nil, session.BadDataError(ctx)
+	}
+	if n := int64(len(rules.UserIds)); n > 0 && (n < totalCount || n > participantsCount) {
+		return nil, session.BadDataError(ctx)
+	}
+	createdAt := time.Now()
 	packet := &Packet{
 		PacketId:        bot.UuidNewV4().String(),
 		UserId:          current.UserId,
@@ -155,7 +277,10 @@ func (current *User) createPacket(ctx context.Context, asset *Asset, amount numb
 		RemainingCount:  totalCount,
 		RemainingAmount: amount.Persist(),
 		State:           PacketStateInitial,
-		CreatedAt:       time.Now(),
+		CreatedAt:       createdAt,
+		Type:            packetType,
+		Rules:           rules,
+		ExpiredAt:       createdAt.Add(time.Duration(expiry) * time.Hour),
 		User:            current,
 		Asset:           asset,
 	}
@@ -231,6 +356,9 @@ func (current *User) ClaimPacket(ctx context.Context, packetId string) (*Packet,
 	if packet.State != PacketStatePaid {
 		return packet, nil
 	}
+	if !packet.Rules.eligible(current) {
+		return nil, session.ForbiddenError(ctx)
+	}
 	if packet.RemainingCount > packet.TotalCount {
 		return nil, session.InsufficientAccountBalanceError(ctx)
 	}
@@ -329,7 +457,7 @@ func SendPacketRefundTransfer(ctx context.Context, packetId string) (*Packet, er
 		TraceId:     traceId,
 		Memo:        "",
 	}
-	err = bot.CreateTransfer(ctx, in, config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey, config.AppConfig.Mixin.SessionAssetPIN, config.AppConfig.Mixin.PinToken)
+	err = session.Transport(ctx).CreateTransfer(ctx, in)
 	if err != nil {
 		return nil, session.ServerError(ctx, err)
 	}
@@ -339,8 +467,8 @@ func SendPacketRefundTransfer(ctx context.Context, packetId string) (*Packet, er
 
 func ListExpiredPackets(ctx context.Context, limit int) ([]string, error) {
 	var packetIds []string
-	query := "SELECT packet_id FROM packets WHERE state IN ($1, $2) AND created_at<$3 LIMIT $4"
-	rows, err := session.Database(ctx).QueryContext(ctx, query, PacketStatePaid, PacketStateExpired, time.Now().Add(-25*time.Hour), limit)
+	query := "SELECT packet_id FROM packets WHERE state IN ($1, $2) AND expired_at<$3 LIMIT $4"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, PacketStatePaid, PacketStateExpired, time.Now().Add(-PacketRefundDelay), limit)
 	if err != nil {
 		return packetIds, session.TransactionError(ctx, err)
 	}
@@ -360,7 +488,11 @@ func handlePacketClaim(ctx context.Context, tx *sql.Tx, packet *Packet, userId s
 		return nil
 	}
 	amount := number.FromString(packet.RemainingAmount)
-	if packet.RemainingCount > 1 && amount.Cmp(number.FromString("0.000001")) > 0 {
+	if packet.Type == PacketTypeEqual {
+		if packet.RemainingCount > 1 {
+			amount = equalPacketShare(number.FromString(packet.Amount), packet.TotalCount)
+		}
+	} else if packet.RemainingCount > 1 && amount.Cmp(number.FromString("0.000001")) > 0 {
 		amount = amount.Mul(number.FromString("2")).Div(number.FromString(fmt.Sprint(packet.RemainingCount)))
 		if amount.Cmp(number.FromString("0.000001")) > 0 {
 			rand.Seed(time.Now().UnixNano())
@@ -390,13 +522,17 @@ func handlePacketClaim(ctx context.Context, tx *sql.Tx, packet *Packet, userId s
 	return err
 }
 
+func equalPacketShare(amount number.Decimal, totalCount int64) number.Decimal {
+	return amount.Div(number.FromString(fmt.Sprint(totalCount))).RoundFloor(8)
+}
+
 func handlePacketExpiration(ctx context.Context, tx *sql.Tx, packet *Packet) error {
 	if packet.State != PacketStatePaid {
 		return nil
 	}
 	if packet.RemainingCount == 0 || number.FromString(packet.RemainingAmount).Exhausted() {
 		packet.State = PacketStateRefunded
-	} else if packet.CreatedAt.Before(time.Now().Add(-24 * time.Hour)) {
+	} else if packet.ExpiredAt.Before(time.Now()) {
 		packet.State = PacketStateExpired
 	}
 	if packet.State == PacketStatePaid {
@@ -442,7 +578,12 @@ func readPacket(ctx context.Context, tx *sql.Tx, packetId string) (*Packet, erro
 
 func packetFromRow(row durable.Row) (*Packet, error) {
 	var p Packet
-	err := row.Scan(&p.PacketId, &p.UserId, &p.AssetId, &p.Amount, &p.Greeting, &p.TotalCount, &p.RemainingCount, &p.RemainingAmount, &p.State, &p.CreatedAt)
+	var rules string
+	err := row.Scan(&p.PacketId, &p.UserId, &p.AssetId, &p.Amount, &p.Greeting, &p.TotalCount, &p.RemainingCount, &p.RemainingAmount, &p.State, &p.CreatedAt, &p.Type, &rules, &p.ExpiredAt)
+	if err != nil {
+		return &p, err
+	}
+	err = json.Unmarshal([]byte(rules), &p.Rules)
 	return &p, err
 }
 
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	PacketHistoryLimit     = 50
+	PacketLeaderboardLimit = 20
+
+	PacketLeaderboardSenders  = "senders"
+	PacketLeaderboardClaimers = "claimers"
+)
+
+var packetLeaderboardPeriods = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+// PacketHistory lists the packets a member sent and the shares claimed, the
+// totals are per asset, the sent amount counts only the shares claimed.
+type PacketHistory struct {
+	Sent     []*Packet
+	Received []*ReceivedPacket
+	Totals   []*PacketAssetTotal
+}
+
+type ReceivedPacket struct {
+	PacketId  string
+	SenderId  string
+	AssetId   string
+	Amount    string
+	CreatedAt time.Time
+}
+
+type PacketAssetTotal struct {
+	AssetId        string
+	SentCount      int64
+	SentAmount     string
+	ReceivedCount  int64
+	ReceivedAmount string
+}
+
+// PacketRank is a place in the leaderboard, the amounts of different assets
+// are compared in USD by the latest asset prices.
+type PacketRank struct {
+	UserId    string
+	FullName  string
+	AvatarURL string
+	Count     int64
+	AmountUSD string
+}
+
+// ReadPacketHistory pages the sent and the received by their own offsets, the
+// next offset of each list is the created_at of its last item.
+func (current *User) ReadPacketHistory(ctx context.Context, sentOffset, receivedOffset time.Time) (*PacketHistory, error) {
+	if sentOffset.IsZero() {
+		sentOffset = time.Now()
+	}
+	if receivedOffset.IsZero() {
+		receivedOffset = time.Now()
+	}
+	sent, err := readSentPackets(ctx, current.UserId, sentOffset)
+	if err != nil {
+		return nil, err
+	}
+	received, err := readReceivedPackets(ctx, current.UserId, receivedOffset)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := readPacketAssetTotals(ctx, current.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return &PacketHistory{Sent: sent, Received: received, Totals: totals}, nil
+}
+
+func readSentPackets(ctx context.Context, userId string, offset time.Time) ([]*Packet, error) {
+	query := fmt.Sprintf("SELECT %s FROM packets WHERE user_id=$1 AND state<>$2 AND created_at<$3 ORDER BY user_id,created_at DESC LIMIT %d", strings.Join(packetsCols, ","), PacketHistoryLimit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, userId, PacketStateInitial, offset)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var packets []*Packet
+	for rows.Next() {
+		p, err := packetFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		packets = append(packets, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return packets, nil
+}
+
+func readReceivedPackets(ctx context.Context, userId string, offset time.Time) ([]*ReceivedPacket, error) {
+	query := fmt.Sprintf("SELECT p.packet_id,pk.user_id,pk.asset_id,p.amount,p.created_at FROM participants p INNER JOIN packets pk ON p.packet_id=pk.packet_id WHERE p.user_id=$1 AND p.created_at<$2 ORDER BY p.user_id,p.created_at DESC LIMIT %d", PacketHistoryLimit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, userId, offset)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var received []*ReceivedPacket
+	for rows.Next() {
+		var r ReceivedPacket
+		err := rows.Scan(&r.PacketId, &r.SenderId, &r.AssetId, &r.Amount, &r.CreatedAt)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		received = append(received, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return received, nil
+}
+
+func readPacketAssetTotals(ctx context.Context, userId string) ([]*PacketAssetTotal, error) {
+	var list []*PacketAssetTotal
+	totals := make(map[string]*PacketAssetTotal)
+	total := func(assetId string) *PacketAssetTotal {
+		if totals[assetId] == nil {
+			totals[assetId] = &PacketAssetTotal{AssetId: assetId, SentAmount: "0", ReceivedAmount: "0"}
+			list = append(list, totals[assetId])
+		}
+		return totals[assetId]
+	}
+	err := readPacketAssetSums(ctx, "SELECT pk.asset_id,COUNT(DISTINCT pk.packet_id),COALESCE(SUM(p.amount::NUMERIC),0)::TEXT FROM packets pk LEFT JOIN participants p ON p.packet_id=pk.packet_id WHERE pk.user_id=$1 AND pk.state<>$2 GROUP BY pk.asset_id", func(assetId string, count int64, amount string) {
+		t := total(assetId)
+		t.SentCount, t.SentAmount = count, amount
+	}, userId, PacketStateInitial)
+	if err != nil {
+		return nil, err
+	}
+	err = readPacketAssetSums(ctx, "SELECT pk.asset_id,COUNT(*),SUM(p.amount::NUMERIC)::TEXT FROM participants p INNER JOIN packets pk ON p.packet_id=pk.packet_id WHERE p.user_id=$1 GROUP BY pk.asset_id", func(assetId string, count int64, amount string) {
+		t := total(assetId)
+		t.ReceivedCount, t.ReceivedAmount = count, amount
+	}, userId)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func readPacketAssetSums(ctx context.Context, query string, fn func(assetId string, count int64, amount string), args ...interface{}) error {
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var assetId, amount string
+		var count int64
+		if err := rows.Scan(&assetId, &count, &amount); err != nil {
+			return session.TransactionError(ctx, err)
+		}
+		fn(assetId, count, number.FromString(amount).Persist())
+	}
+	if err := rows.Err(); err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// PacketLeaderboard ranks the senders by the shares claimed from their packets,
+// and the claimers by the shares they claimed, in the period of day, week,
+// month or all.
+func PacketLeaderboard(ctx context.Context, category, period string) ([]*PacketRank, error) {
+	duration, found := packetLeaderboardPeriods[period]
+	if !found {
+		return nil, session.BadDataError(ctx)
+	}
+	since := time.Time{}
+	if duration > 0 {
+		since = time.Now().Add(-duration)
+	}
+	var groupBy, count string
+	switch category {
+	case PacketLeaderboardSenders:
+		groupBy, count = "pk.user_id", "COUNT(DISTINCT pk.packet_id)"
+	case PacketLeaderboardClaimers:
+		groupBy, count = "p.user_id", "COUNT(*)"
+	default:
+		return nil, session.BadDataError(ctx)
+	}
+	query := fmt.Sprintf(`SELECT r.user_id,u.full_name,u.avatar_url,r.count,r.amount::TEXT FROM (
+		SELECT %s AS user_id,%s AS count,SUM(p.amount::NUMERIC * COALESCE(NULLIF(a.price_usd,''),'0')::NUMERIC) AS amount
+		FROM participants p INNER JOIN packets pk ON p.packet_id=pk.packet_id LEFT JOIN assets a ON pk.asset_id=a.asset_id
+		WHERE p.created_at>$1 GROUP BY %s
+	) r INNER JOIN users u ON r.user_id=u.user_id ORDER BY r.amount DESC,r.count DESC LIMIT %d`, groupBy, count, groupBy, PacketLeaderboardLimit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var ranks []*PacketRank
+	for rows.Next() {
+		var r PacketRank
+		err := rows.Scan(&r.UserId, &r.FullName, &r.AvatarURL, &r.Count, &r.AmountUSD)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		r.AmountUSD = number.FromString(r.AmountUSD).RoundFloor(2).Persist()
+		ranks = append(ranks, &r)
+	}
+	return ranks, nil
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketHistory(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	err = testPayment(ctx, user, SubscriptionPlanLifetime)
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	err = testPayment(ctx, li, SubscriptionPlanLifetime)
+	assert.Nil(err)
+
+	asset := &Asset{
+		AssetId:  bot.UuidNewV4().String(),
+		Symbol:   "XIN",
+		Name:     "Mixin",
+		IconURL:  "http://mixin.one",
+		PriceBTC: "0",
+		PriceUSD: "100",
+		Balance:  "100",
+	}
+	err = upsertAssets(ctx, []*Asset{asset})
+	assert.Nil(err)
+	packet, err := li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeEqual, PacketRules{}, 0)
+	assert.Nil(err)
+	_, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeEqual, PacketRules{}, 0)
+	assert.Nil(err)
+	_, err = PayPacket(ctx, packet.PacketId, asset.AssetId, "1")
+	assert.Nil(err)
+	_, err = user.ClaimPacket(ctx, packet.PacketId)
+	assert.Nil(err)
+
+	history, err := li.ReadPacketHistory(ctx, time.Time{}, time.Time{})
+	assert.Nil(err)
+	assert.Len(history.Sent, 1)
+	assert.Len(history.Received, 0)
+	assert.Len(history.Totals, 1)
+	assert.Equal(int64(1), history.Totals[0].SentCount)
+	assert.Equal("0.5", history.Totals[0].SentAmount)
+	assert.Equal("0", history.Totals[0].ReceivedAmount)
+	history, err = user.ReadPacketHistory(ctx, time.Time{}, time.Time{})
+	assert.Nil(err)
+	assert.Len(history.Sent, 0)
+	assert.Len(history.Received, 1)
+	assert.Equal(li.UserId, history.Received[0].SenderId)
+	assert.Equal("0.5", history.Received[0].Amount)
+	assert.Equal("0.5", history.Totals[0].ReceivedAmount)
+	history, err = user.ReadPacketHistory(ctx, time.Time{}, time.Now().Add(-time.Hour))
+	assert.Nil(err)
+	assert.Len(history.Received, 0)
+	history, err = li.ReadPacketHistory(ctx, time.Time{}, time.Now().Add(-time.Hour))
+	assert.Nil(err)
+	assert.Len(history.Sent, 1)
+	history, err = li.ReadPacketHistory(ctx, time.Now().Add(-time.Hour), time.Time{})
+	assert.Nil(err)
+	assert.Len(history.Sent, 0)
+
+	ranks, err := PacketLeaderboard(ctx, PacketLeaderboardSenders, "week")
+	assert.Nil(err)
+	assert.Len(ranks, 1)
+	assert.Equal(li.UserId, ranks[0].UserId)
+	assert.Equal(int64(1), ranks[0].Count)
+	assert.Equal("50", ranks[0].AmountUSD)
+	ranks, err = PacketLeaderboard(ctx, PacketLeaderboardClaimers, "all")
+	assert.Nil(err)
+	assert.Len(ranks, 1)
+	assert.Equal(user.UserId, ranks[0].UserId)
+	_, err = PacketLeaderboard(ctx, PacketLeaderboardClaimers, "year")
+	assert.NotNil(err)
+	_, err = PacketLeaderboard(ctx, "unknown", "week")
+	assert.NotNil(err)
+}
@@ -25,7 +25,7 @@ func TestPacketCRUD(t *testing.T) {
 	sum, err := user.Prepare(ctx)
 	assert.Nil(err)
 	assert.Equal(int64(1), sum)
-	err = user.Payment(ctx)
+	err = testPayment(ctx, user, SubscriptionPlanLifetime)
 	assert.Nil(err)
 
 	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
@@ -36,7 +36,7 @@ func TestPacketCRUD(t *testing.T) {
 	sum, err = user.Prepare(ctx)
 	assert.Nil(err)
 	assert.Equal(int64(2), sum)
-	err = li.Payment(ctx)
+	err = testPayment(ctx, li, SubscriptionPlanLifetime)
 	assert.Nil(err)
 
 	asset := &Asset{
@@ -50,7 +50,7 @@ func TestPacketCRUD(t *testing.T) {
 	}
 	err = upsertAssets(ctx, []*Asset{asset})
 	assert.Nil(err)
-	packet, err := li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet")
+	packet, err := li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeLucky, PacketRules{}, 0)
 	assert.Nil(err)
 	assert.NotNil(packet)
 	assert.Equal(PacketStateInitial, packet.State)
@@ -81,14 +81,14 @@ func TestPacketCRUD(t *testing.T) {
 	assert.Equal(int64(0), packet.RemainingCount)
 	assert.Equal("0", packet.RemainingAmount)
 	assert.Len(packet.Participants, 2)
-	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet")
+	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeLucky, PacketRules{}, 0)
 	assert.Nil(err)
 	assert.NotNil(packet)
 	packet, err = PayPacket(ctx, packet.PacketId, asset.AssetId, "1")
 	assert.Nil(err)
 	assert.NotNil(packet)
 	assert.Equal(PacketStatePaid, packet.State)
-	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE packets SET created_at=$1 WHERE packet_id=$2", time.Now().Add(-25*time.Hour), packet.PacketId)
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE packets SET (created_at,expired_at)=($1,$2) WHERE packet_id=$3", time.Now().Add(-25*time.Hour), time.Now().Add(-time.Hour-time.Minute), packet.PacketId)
 	assert.Nil(err)
 	packet, err = ShowPacket(ctx, packet.PacketId)
 	assert.Nil(err)
@@ -107,6 +107,76 @@ func TestPacketCRUD(t *testing.T) {
 	packet, err = testReadPacketWithRelation(ctx, bot.UuidNewV4().String())
 	assert.Nil(err)
 	assert.Nil(packet)
+
+	packet, err = li.createPacket(ctx, asset, number.FromString("0.00000003"), 2, "Hello Packet", PacketTypeEqual, PacketRules{}, 0)
+	assert.NotNil(err)
+	assert.Nil(packet)
+	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", "unknown", PacketRules{}, 0)
+	assert.NotNil(err)
+	assert.Nil(packet)
+	packet, err = li.createPacket(ctx, asset, number.FromString("0.00010001"), 2, "Hello Packet", PacketTypeEqual, PacketRules{}, 0)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	assert.Equal(PacketTypeEqual, packet.Type)
+	packet, err = PayPacket(ctx, packet.PacketId, asset.AssetId, "0.00010001")
+	assert.Nil(err)
+	assert.NotNil(packet)
+	packet, err = user.ClaimPacket(ctx, packet.PacketId)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	packet, err = li.ClaimPacket(ctx, packet.PacketId)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	packet, err = ShowPacket(ctx, packet.PacketId)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	assert.Equal("0", packet.RemainingAmount)
+	assert.Len(packet.Participants, 2)
+	amounts := make(map[string]string)
+	for _, p := range packet.Participants {
+		amounts[p.UserId] = p.Amount
+	}
+	assert.Equal("0.00005", amounts[user.UserId])
+	assert.Equal("0.00005001", amounts[li.UserId])
+
+	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeLucky, PacketRules{UserIds: []string{user.UserId}}, 0)
+	assert.NotNil(err)
+	assert.Nil(packet)
+	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 1, "Hello Packet", PacketTypeLucky, PacketRules{UserIds: []string{user.UserId, user.UserId}}, 0)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	assert.Equal([]string{user.UserId}, packet.Rules.UserIds)
+	packet, err = PayPacket(ctx, packet.PacketId, asset.AssetId, "1")
+	assert.Nil(err)
+	assert.NotNil(packet)
+	packet, err = li.ClaimPacket(ctx, packet.PacketId)
+	assert.NotNil(err)
+	assert.Nil(packet)
+	li.ActiveAt = time.Now().Add(-72 * time.Hour)
+	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeLucky, PacketRules{ActiveDays: 2, JoinedBefore: time.Now()}, 0)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	packet, err = PayPacket(ctx, packet.PacketId, asset.AssetId, "1")
+	assert.Nil(err)
+	assert.NotNil(packet)
+	packet, err = ShowPacket(ctx, packet.PacketId)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	assert.Equal(int64(2), packet.Rules.ActiveDays)
+	_, err = li.ClaimPacket(ctx, packet.PacketId)
+	assert.NotNil(err)
+	packet, err = user.ClaimPacket(ctx, packet.PacketId)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	assert.Equal(int64(1), packet.RemainingCount)
+
+	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeLucky, PacketRules{}, PacketDefaultExpiry+1)
+	assert.NotNil(err)
+	assert.Nil(packet)
+	packet, err = li.createPacket(ctx, asset, number.FromString("1"), 2, "Hello Packet", PacketTypeLucky, PacketRules{}, 2)
+	assert.Nil(err)
+	assert.NotNil(packet)
+	assert.Equal(packet.CreatedAt.Add(2*time.Hour), packet.ExpiredAt)
 }
 
 func testReadPacketWithRelation(ctx context.Context, packetId string) (*Packet, error) {
@@ -30,6 +30,7 @@ CREATE TABLE IF NOT EXISTS participants (
 );
 
 CREATE INDEX IF NOT EXISTS participants_created_paidx ON participants(created_at, paid_at);
+CREATE INDEX IF NOT EXISTS participants_user_createdx ON participants(user_id, created_at);
 `
 
 type Participant struct {
@@ -93,7 +94,7 @@ func SendParticipantTransfer(ctx context.Context, packetId, userId string, amoun
 		}
 		// tmp patch
 		if packet == nil {
-			session.Logger(ctx).Infof("Debug Info: read packet user error , packet.User is nil, packetId: %d", packetId)
+			session.Logger(ctx).Infof("Debug Info: read packet user error , packet.User is nil, packetId: %s", packetId)
 			return nil
 		}
 		// end tmp patch
@@ -113,7 +114,7 @@ func SendParticipantTransfer(ctx context.Context, packetId, userId string, amoun
 			Memo:        memo,
 		}
 		if !number.FromString(amount).Exhausted() {
-			err = bot.CreateTransfer(ctx, in, config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey, config.AppConfig.Mixin.SessionAssetPIN, config.AppConfig.Mixin.PinToken)
+			err = session.Transport(ctx).CreateTransfer(ctx, in)
 			if err != nil {
 				return err
 			}
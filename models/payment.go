@@ -0,0 +1,158 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	PaymentResultMatched   = "matched"
+	PaymentResultOverpaid  = "overpaid"
+	PaymentResultUnderpaid = "underpaid"
+	PaymentResultUnknown   = "unknown"
+
+	PaymentsLimit       = 100
+	PaymentsExportLimit = 10000
+)
+
+const payments_DDL = `
+CREATE TABLE IF NOT EXISTS payments (
+	snapshot_id        VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	trace_id           VARCHAR(36) NOT NULL CHECK (trace_id ~* '^[0-9a-f-]{36,36}$'),
+	asset_id           VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+	amount             VARCHAR(128) NOT NULL,
+	expected_amount    VARCHAR(128) NOT NULL DEFAULT '',
+	plan               VARCHAR(128) NOT NULL DEFAULT '',
+	result             VARCHAR(128) NOT NULL,
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS payments_createdx ON payments(created_at);
+CREATE INDEX IF NOT EXISTS payments_user_createdx ON payments(user_id, created_at);
+`
+
+var paymentsCols = []string{"snapshot_id", "user_id", "trace_id", "asset_id", "amount", "expected_amount", "plan", "result", "created_at"}
+
+func (p *Payment) values() []interface{} {
+	return []interface{}{p.SnapshotId, p.UserId, p.TraceId, p.AssetId, p.Amount, p.ExpectedAmount, p.Plan, p.Result, p.CreatedAt}
+}
+
+func paymentFromRow(row durable.Row) (*Payment, error) {
+	var p Payment
+	err := row.Scan(&p.SnapshotId, &p.UserId, &p.TraceId, &p.AssetId, &p.Amount, &p.ExpectedAmount, &p.Plan, &p.Result, &p.CreatedAt)
+	return &p, err
+}
+
+// Payment is a join or renewal transfer, those not matching any plan price
+// are recorded too so they could be reconciled or refunded.
+type Payment struct {
+	SnapshotId     string
+	UserId         string
+	TraceId        string
+	AssetId        string
+	Amount         string
+	ExpectedAmount string
+	Plan           string
+	Result         string
+	CreatedAt      time.Time
+}
+
+type PaymentFilter struct {
+	UserId string
+	Result string
+	Since  time.Time
+	Until  time.Time
+}
+
+// classify fills the plan and result with the prices after discount, an
+// amount between prices is compared with the highest price below it.
+func (p *Payment) classify(discount int64) {
+	p.Result = PaymentResultUnknown
+	var lower, upper number.Decimal
+	var lowerPlan, upperPlan string
+	amount := number.FromString(p.Amount)
+	for _, plan := range config.AppConfig.System.SubscriptionPlans {
+		if _, found := subscriptionPlanDurations[plan.Name]; !found {
+			continue
+		}
+		for _, asset := range plan.Assets {
+			if asset.AssetId != p.AssetId {
+				continue
+			}
+			price := discountPrice(asset.Amount, discount)
+			if amount.Equal(price) {
+				p.Plan, p.ExpectedAmount, p.Result = plan.Name, price.Persist(), PaymentResultMatched
+				return
+			}
+			if price.Cmp(amount) < 0 && (lowerPlan == "" || price.Cmp(lower) > 0) {
+				lower, lowerPlan = price, plan.Name
+			}
+			if price.Cmp(amount) > 0 && (upperPlan == "" || price.Cmp(upper) < 0) {
+				upper, upperPlan = price, plan.Name
+			}
+		}
+	}
+	if lowerPlan != "" {
+		p.Plan, p.ExpectedAmount, p.Result = lowerPlan, lower.Persist(), PaymentResultOverpaid
+	} else if upperPlan != "" {
+		p.Plan, p.ExpectedAmount, p.Result = upperPlan, upper.Persist(), PaymentResultUnderpaid
+	}
+}
+
+// createPaymentInTx returns false if the snapshot has been recorded already.
+func createPaymentInTx(ctx context.Context, tx *sql.Tx, p *Payment) (bool, error) {
+	params, positions := compileTableQuery(paymentsCols)
+	query := fmt.Sprintf("INSERT INTO payments (%s) VALUES (%s) ON CONFLICT (snapshot_id) DO NOTHING", params, positions)
+	r, err := tx.ExecContext(ctx, query, p.values()...)
+	if err != nil {
+		return false, err
+	}
+	count, err := r.RowsAffected()
+	return count > 0, err
+}
+
+func (current *User) ReadPayments(ctx context.Context, filter PaymentFilter, limit int) ([]*Payment, error) {
+	if !current.Can(PermissionPayment) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if filter.Until.IsZero() {
+		filter.Until = time.Now()
+	}
+	conditions := []string{"created_at>=$1", "created_at<$2"}
+	args := []interface{}{filter.Since, filter.Until}
+	for _, c := range []struct{ col, value string }{
+		{"user_id", filter.UserId},
+		{"result", filter.Result},
+	} {
+		if c.value == "" {
+			continue
+		}
+		args = append(args, c.value)
+		conditions = append(conditions, fmt.Sprintf("%s=$%d", c.col, len(args)))
+	}
+	query := fmt.Sprintf("SELECT %s FROM payments WHERE %s ORDER BY created_at DESC LIMIT %d", strings.Join(paymentsCols, ","), strings.Join(conditions, " AND "), limit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var payments []*Payment
+	for rows.Next() {
+		p, err := paymentFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		payments = append(payments, p)
+	}
+	return payments, nil
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	setupTestPlans()
+	for amount, result := range map[string][]string{
+		"0.001":  {SubscriptionPlanMonthly, "0.001", PaymentResultMatched},
+		"0.002":  {SubscriptionPlanMonthly, "0.001", PaymentResultOverpaid},
+		"0.0001": {SubscriptionPlanMonthly, "0.001", PaymentResultUnderpaid},
+		"0.2":    {SubscriptionPlanLifetime, "0.1", PaymentResultOverpaid},
+	} {
+		p := &Payment{AssetId: testPaymentAssetId, Amount: amount}
+		p.classify(0)
+		assert.Equal(result, []string{p.Plan, p.ExpectedAmount, p.Result})
+	}
+	p := &Payment{AssetId: bot.UuidNewV4().String(), Amount: "0.001"}
+	p.classify(0)
+	assert.Equal(PaymentResultUnknown, p.Result)
+	assert.Equal("", p.Plan)
+
+	user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "admin", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+
+	under := testTransfer(user, "0.0001")
+	err = user.Payment(ctx, under)
+	assert.Nil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, user.State)
+
+	matched := testTransfer(user, "0.1")
+	err = user.Payment(ctx, matched)
+	assert.Nil(err)
+	err = user.Payment(ctx, matched)
+	assert.Nil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+
+	payments, err := user.ReadPayments(ctx, PaymentFilter{}, PaymentsLimit)
+	assert.NotNil(err)
+	assert.Len(payments, 0)
+	payments, err = admin.ReadPayments(ctx, PaymentFilter{}, PaymentsLimit)
+	assert.Nil(err)
+	assert.Len(payments, 2)
+	payments, err = admin.ReadPayments(ctx, PaymentFilter{UserId: user.UserId, Result: PaymentResultUnderpaid}, PaymentsLimit)
+	assert.Nil(err)
+	assert.Len(payments, 1)
+	assert.Equal(under.SnapshotId, payments[0].SnapshotId)
+	assert.Equal("0.001", payments[0].ExpectedAmount)
+	payments, err = admin.ReadPayments(ctx, PaymentFilter{Since: time.Now()}, PaymentsLimit)
+	assert.Nil(err)
+	assert.Len(payments, 0)
+}
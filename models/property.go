@@ -43,7 +43,10 @@ type Property struct {
 	CreatedAt time.Time
 }
 
-func CreateProperty(ctx context.Context, name string, value bool) (*Property, error) {
+func (current *User) CreateProperty(ctx context.Context, name string, value bool) (*Property, error) {
+	if !current.Can(PermissionProperty) {
+		return nil, session.ForbiddenError(ctx)
+	}
 	property := &Property{
 		Name:      name,
 		Value:     fmt.Sprint(value),
@@ -51,7 +54,7 @@ func CreateProperty(ctx context.Context, name string, value bool) (*Property, er
 	}
 	params, positions := compileTableQuery(propertiesColumns)
 	query := fmt.Sprintf("INSERT INTO properties (%s) VALUES (%s) ON CONFLICT (name) DO UPDATE SET value=EXCLUDED.value", params, positions)
-	session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
 		_, err := tx.ExecContext(ctx, query, property.values()...)
 		if err != nil {
 			return err
@@ -61,10 +64,12 @@ func CreateProperty(ctx context.Context, name string, value bool) (*Property, er
 		if value {
 			text = data.MessageTemplate.MessageProhibit
 		}
-		return createSystemMessage(ctx, tx, MessageCategoryPlainText, base64.StdEncoding.EncodeToString([]byte(text)))
-		return nil
+		err = createSystemMessage(ctx, tx, MessageCategoryPlainText, base64.StdEncoding.EncodeToString([]byte(text)))
+		if err != nil {
+			return err
+		}
+		return createAuditLogInTx(ctx, tx, current.UserId, AuditActionProperty, property.Name, property.Value)
 	})
-	_, err := session.Database(ctx).ExecContext(ctx, query, property.values()...)
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"testing"
 
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,7 +20,10 @@ func TestPropertyCRUD(t *testing.T) {
 	b, err := testReadPropertyAsBool(ctx, name)
 	assert.False(b)
 	assert.Nil(err)
-	p, err := CreateProperty(ctx, name, true)
+	admin := &User{UserId: bot.UuidNewV4().String()}
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+
+	p, err := admin.CreateProperty(ctx, name, true)
 	assert.Nil(err)
 	assert.NotNil(p)
 	p, err = ReadProperty(ctx, name)
@@ -31,7 +36,7 @@ func TestPropertyCRUD(t *testing.T) {
 	b, err = testReadPropertyAsBool(ctx, name)
 	assert.True(b)
 	assert.Nil(err)
-	p, err = CreateProperty(ctx, name, false)
+	p, err = admin.CreateProperty(ctx, name, false)
 	assert.Nil(err)
 	assert.NotNil(p)
 	p, err = ReadProperty(ctx, name)
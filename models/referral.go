@@ -0,0 +1,190 @@
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid"
+)
+
+const referral_rewards_DDL = `
+CREATE TABLE IF NOT EXISTS referral_rewards (
+	snapshot_id        VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+	referrer_id        VARCHAR(36) NOT NULL CHECK (referrer_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	asset_id           VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+	amount             VARCHAR(128) NOT NULL,
+	paid_at            TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS referral_rewards_paidx ON referral_rewards(paid_at);
+CREATE INDEX IF NOT EXISTS referral_rewards_referrer_createdx ON referral_rewards(referrer_id, created_at);
+`
+
+var referralRewardsCols = []string{"snapshot_id", "referrer_id", "user_id", "asset_id", "amount", "paid_at", "created_at"}
+
+func (r *ReferralReward) values() []interface{} {
+	return []interface{}{r.SnapshotId, r.ReferrerId, r.UserId, r.AssetId, r.Amount, r.PaidAt, r.CreatedAt}
+}
+
+func referralRewardFromRow(row durable.Row) (*ReferralReward, error) {
+	var r ReferralReward
+	err := row.Scan(&r.SnapshotId, &r.ReferrerId, &r.UserId, &r.AssetId, &r.Amount, &r.PaidAt, &r.CreatedAt)
+	return &r, err
+}
+
+// ReferralReward is the share of a join fee paid to the referrer, it's keyed
+// by the snapshot of the join fee, the zero paid_at means it's pending.
+type ReferralReward struct {
+	SnapshotId string
+	ReferrerId string
+	UserId     string
+	AssetId    string
+	Amount     string
+	PaidAt     time.Time
+	CreatedAt  time.Time
+}
+
+// SetReferrer accepts the user id or identity number of a paid member, it's
+// only set once and before joining, an invalid referrer is ignored.
+func (user *User) SetReferrer(ctx context.Context, referrer string) error {
+	referrer = strings.TrimSpace(referrer)
+	if referrer == "" || user.State != PaymentStatePending || user.ReferrerId != "" {
+		return nil
+	}
+	var found *User
+	if id, err := bot.UuidFromString(referrer); err == nil {
+		u, err := FindUser(ctx, id.String())
+		if err != nil {
+			return err
+		}
+		found = u
+	} else if identity, err := strconv.ParseInt(referrer, 10, 64); err == nil {
+		users, err := findUsersByIdentityNumber(ctx, identity)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			found = users[0]
+		}
+	}
+	if found == nil || found.UserId == user.UserId || found.State != PaymentStatePaid {
+		return nil
+	}
+	query := "UPDATE users SET referrer_id=$1 WHERE user_id=$2 AND referrer_id=''"
+	_, err := session.Database(ctx).ExecContext(ctx, query, found.UserId, user.UserId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	user.ReferrerId = found.UserId
+	return nil
+}
+
+// createReferralRewardInTx gives the referrer referral_reward_percent of the
+// join fee, the renewals are not rewarded.
+func createReferralRewardInTx(ctx context.Context, tx *sql.Tx, user *User, payment *Payment) error {
+	percent := config.AppConfig.System.ReferralRewardPercent
+	if user.ReferrerId == "" || percent <= 0 || percent > 100 {
+		return nil
+	}
+	amount := number.FromString(payment.Amount).Mul(number.FromString(fmt.Sprint(percent))).Div(number.FromString("100")).RoundFloor(8)
+	if amount.Exhausted() {
+		return nil
+	}
+	r := &ReferralReward{
+		SnapshotId: payment.SnapshotId,
+		ReferrerId: user.ReferrerId,
+		UserId:     user.UserId,
+		AssetId:    payment.AssetId,
+		Amount:     amount.Persist(),
+		PaidAt:     time.Time{},
+		CreatedAt:  time.Now(),
+	}
+	params, positions := compileTableQuery(referralRewardsCols)
+	query := fmt.Sprintf("INSERT INTO referral_rewards (%s) VALUES (%s) ON CONFLICT (snapshot_id) DO NOTHING", params, positions)
+	_, err := tx.ExecContext(ctx, query, r.values()...)
+	return err
+}
+
+func PendingReferralRewards(ctx context.Context, limit int) ([]*ReferralReward, error) {
+	query := fmt.Sprintf("SELECT %s FROM referral_rewards WHERE paid_at=$1 LIMIT %d", strings.Join(referralRewardsCols, ","), limit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, time.Time{})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var rewards []*ReferralReward
+	for rows.Next() {
+		r, err := referralRewardFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		rewards = append(rewards, r)
+	}
+	return rewards, nil
+}
+
+func SendReferralRewardTransfer(ctx context.Context, reward *ReferralReward) error {
+	traceId, err := generateReferralRewardId(reward.SnapshotId)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	if !reward.PaidAt.IsZero() {
+		return nil
+	}
+	user, err := FindUser(ctx, reward.UserId)
+	if err != nil {
+		return err
+	}
+	// the joiner banned or kicked is deleted, the reward is still paid but
+	// without the name in the memo.
+	var memo string
+	if tpl := config.AppConfig.MessageTemplate.MessageReferralMemo; tpl != "" && user != nil {
+		memo = fmt.Sprintf(tpl, user.FullName)
+	}
+	in := &bot.TransferInput{
+		AssetId:     reward.AssetId,
+		RecipientId: reward.ReferrerId,
+		Amount:      number.FromString(reward.Amount),
+		TraceId:     traceId,
+		Memo:        transferMemo(memo),
+	}
+	err = session.Transport(ctx).CreateTransfer(ctx, in)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	return UpdateReferralReward(ctx, reward.SnapshotId)
+}
+
+func UpdateReferralReward(ctx context.Context, snapshotId string) error {
+	query := "UPDATE referral_rewards SET paid_at=$1 WHERE snapshot_id=$2"
+	_, err := session.Database(ctx).ExecContext(ctx, query, time.Now(), snapshotId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func generateReferralRewardId(snapshotId string) (string, error) {
+	h := md5.New()
+	io.WriteString(h, snapshotId)
+	io.WriteString(h, "REFERRAL")
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x30
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	id, err := uuid.FromBytes(sum)
+	return id.String(), err
+}
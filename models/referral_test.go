@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferralRewardCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	referrer, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "referrer", "http://localhost")
+	assert.Nil(err)
+	user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "user", "http://localhost")
+	assert.Nil(err)
+
+	err = user.SetReferrer(ctx, referrer.UserId)
+	assert.Nil(err)
+	assert.Equal("", user.ReferrerId)
+	err = testPayment(ctx, referrer, SubscriptionPlanLifetime)
+	assert.Nil(err)
+	err = user.SetReferrer(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal("", user.ReferrerId)
+	err = user.SetReferrer(ctx, "1000")
+	assert.Nil(err)
+	assert.Equal(referrer.UserId, user.ReferrerId)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(referrer.UserId, user.ReferrerId)
+
+	config.AppConfig.System.ReferralRewardPercent = 10
+	setupTestPlans()
+	payment := testTransfer(user, "0.001")
+	err = user.Payment(ctx, payment)
+	assert.Nil(err)
+	rewards, err := PendingReferralRewards(ctx, 10)
+	assert.Nil(err)
+	assert.Len(rewards, 1)
+	assert.Equal(payment.SnapshotId, rewards[0].SnapshotId)
+	assert.Equal(referrer.UserId, rewards[0].ReferrerId)
+	assert.Equal("0.0001", rewards[0].Amount)
+
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	err = user.Payment(ctx, testTransfer(user, "0.001"))
+	assert.Nil(err)
+	rewards, err = PendingReferralRewards(ctx, 10)
+	assert.Nil(err)
+	assert.Len(rewards, 1)
+
+	transport := &testTransport{}
+	ctx = session.WithTransport(ctx, transport)
+	config.AppConfig.MessageTemplate.MessageReferralMemo = "Referral reward of %s"
+	_, err = session.Database(ctx).ExecContext(ctx, "DELETE FROM users WHERE user_id=$1", user.UserId)
+	assert.Nil(err)
+	err = SendReferralRewardTransfer(ctx, rewards[0])
+	assert.Nil(err)
+	assert.Len(transport.transfers, 1)
+	assert.Equal(referrer.UserId, transport.transfers[0].RecipientId)
+	assert.Equal("", transport.transfers[0].Memo)
+	rewards, err = PendingReferralRewards(ctx, 10)
+	assert.Nil(err)
+	assert.Len(rewards, 0)
+}
+
+type testTransport struct {
+	transfers []*bot.TransferInput
+}
+
+func (t *testTransport) ConnectBlaze(ctx context.Context) (*websocket.Conn, error) {
+	return nil, nil
+}
+
+func (t *testTransport) PostMessages(ctx context.Context, key string, messages []byte) error {
+	return nil
+}
+
+func (t *testTransport) CreateTransfer(ctx context.Context, in *bot.TransferInput) error {
+	t.transfers = append(t.transfers, in)
+	return nil
+}
+
+func (t *testTransport) ShowAttachment(ctx context.Context, id string) (*bot.Attachment, error) {
+	return nil, nil
+}
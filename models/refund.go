@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	RefundReasonOverpaid  = PaymentResultOverpaid
+	RefundReasonUnderpaid = PaymentResultUnderpaid
+	RefundReasonUnknown   = PaymentResultUnknown
+	RefundReasonUntraced  = "untraced"
+	RefundReasonPacket    = "packet"
+
+	RefundsLimit = 100
+)
+
+var defaultRefundMemos = map[string]string{
+	RefundReasonOverpaid:  "Refund: the amount is more than the plan price",
+	RefundReasonUnderpaid: "Refund: the amount is less than the plan price",
+	RefundReasonUnknown:   "Refund: the asset or amount matches no plan",
+	RefundReasonUntraced:  "Refund: the transfer matches no payment or packet",
+	RefundReasonPacket:    "Refund: the asset or amount mismatches the packet",
+}
+
+const refunds_DDL = `
+CREATE TABLE IF NOT EXISTS refunds (
+	snapshot_id        VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	asset_id           VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+	amount             VARCHAR(128) NOT NULL,
+	reason             VARCHAR(128) NOT NULL,
+	paid_at            TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_paidx ON refunds(paid_at);
+CREATE INDEX IF NOT EXISTS refunds_createdx ON refunds(created_at);
+`
+
+var refundsCols = []string{"snapshot_id", "user_id", "asset_id", "amount", "reason", "paid_at", "created_at"}
+
+func (r *Refund) values() []interface{} {
+	return []interface{}{r.SnapshotId, r.UserId, r.AssetId, r.Amount, r.Reason, r.PaidAt, r.CreatedAt}
+}
+
+func refundFromRow(row durable.Row) (*Refund, error) {
+	var r Refund
+	err := row.Scan(&r.SnapshotId, &r.UserId, &r.AssetId, &r.Amount, &r.Reason, &r.PaidAt, &r.CreatedAt)
+	return &r, err
+}
+
+// Refund returns a transfer the group could not accept to the sender, the
+// zero paid_at means it's pending.
+type Refund struct {
+	SnapshotId string
+	UserId     string
+	AssetId    string
+	Amount     string
+	Reason     string
+	PaidAt     time.Time
+	CreatedAt  time.Time
+}
+
+// refundPolicyAllows reads the refund_policy in config.yaml, the transfers not
+// refunded are kept, and those of join fees stay in the payments ledger.
+func refundPolicyAllows(reason string) bool {
+	policy := config.AppConfig.System.RefundPolicy
+	switch reason {
+	case RefundReasonOverpaid:
+		return policy.Overpaid
+	case RefundReasonUnderpaid:
+		return policy.Underpaid
+	case RefundReasonUnknown:
+		return policy.Unknown
+	case RefundReasonUntraced:
+		return policy.Untraced
+	case RefundReasonPacket:
+		return policy.Packet
+	}
+	return false
+}
+
+// CreateRefund skips the snapshots already in the payments ledger, because
+// the trace id of a member rotates after payment, a snapshot delivered again
+// would otherwise look untraced.
+func CreateRefund(ctx context.Context, snapshotId, userId, assetId, amount, reason string) error {
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var id string
+		err := tx.QueryRowContext(ctx, "SELECT snapshot_id FROM payments WHERE snapshot_id=$1", snapshotId).Scan(&id)
+		if err == nil {
+			return nil
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+		return createRefundInTx(ctx, tx, snapshotId, userId, assetId, amount, reason)
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func createRefundInTx(ctx context.Context, tx *sql.Tx, snapshotId, userId, assetId, amount, reason string) error {
+	if !refundPolicyAllows(reason) {
+		return nil
+	}
+	if _, err := bot.UuidFromString(snapshotId); err != nil {
+		return nil
+	}
+	if number.FromString(amount).Cmp(number.Zero()) <= 0 {
+		return nil
+	}
+	r := &Refund{
+		SnapshotId: snapshotId,
+		UserId:     userId,
+		AssetId:    assetId,
+		Amount:     amount,
+		Reason:     reason,
+		PaidAt:     time.Time{},
+		CreatedAt:  time.Now(),
+	}
+	params, positions := compileTableQuery(refundsCols)
+	query := fmt.Sprintf("INSERT INTO refunds (%s) VALUES (%s) ON CONFLICT (snapshot_id) DO NOTHING", params, positions)
+	_, err := tx.ExecContext(ctx, query, r.values()...)
+	return err
+}
+
+func PendingRefunds(ctx context.Context, limit int) ([]*Refund, error) {
+	query := fmt.Sprintf("SELECT %s FROM refunds WHERE paid_at=$1 LIMIT %d", strings.Join(refundsCols, ","), limit)
+	return findRefundsByQuery(ctx, query, time.Time{})
+}
+
+func SendRefundTransfer(ctx context.Context, refund *Refund) error {
+	traceId, err := generateRefundId(refund.SnapshotId)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	if !refund.PaidAt.IsZero() {
+		return nil
+	}
+	memo := config.AppConfig.MessageTemplate.RefundMemos[refund.Reason]
+	if memo == "" {
+		memo = defaultRefundMemos[refund.Reason]
+	}
+	in := &bot.TransferInput{
+		AssetId:     refund.AssetId,
+		RecipientId: refund.UserId,
+		Amount:      number.FromString(refund.Amount),
+		TraceId:     traceId,
+		Memo:        transferMemo(memo),
+	}
+	err = session.Transport(ctx).CreateTransfer(ctx, in)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	return UpdateRefund(ctx, refund.SnapshotId)
+}
+
+func UpdateRefund(ctx context.Context, snapshotId string) error {
+	query := "UPDATE refunds SET paid_at=$1 WHERE snapshot_id=$2"
+	_, err := session.Database(ctx).ExecContext(ctx, query, time.Now(), snapshotId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (current *User) ReadRefunds(ctx context.Context, offset time.Time) ([]*Refund, error) {
+	if !current.Can(PermissionRefund) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if offset.IsZero() {
+		offset = time.Now()
+	}
+	query := fmt.Sprintf("SELECT %s FROM refunds WHERE created_at<$1 ORDER BY created_at DESC LIMIT %d", strings.Join(refundsCols, ","), RefundsLimit)
+	return findRefundsByQuery(ctx, query, offset)
+}
+
+func findRefundsByQuery(ctx context.Context, query string, args ...interface{}) ([]*Refund, error) {
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var refunds []*Refund
+	for rows.Next() {
+		r, err := refundFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, nil
+}
+
+func generateRefundId(snapshotId string) (string, error) {
+	h := md5.New()
+	io.WriteString(h, snapshotId)
+	io.WriteString(h, "TRANSFER_REFUND")
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x30
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	id, err := uuid.FromBytes(sum)
+	return id.String(), err
+}
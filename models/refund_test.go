@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefundCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "admin", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+
+	config.AppConfig.System.RefundPolicy = config.RefundPolicy{}
+	setupTestPlans()
+	err = user.Payment(ctx, testTransfer(user, "0.002"))
+	assert.Nil(err)
+	refunds, err := PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 0)
+
+	config.AppConfig.System.RefundPolicy = config.RefundPolicy{Overpaid: true, Untraced: true}
+	over := testTransfer(user, "0.002")
+	err = user.Payment(ctx, over)
+	assert.Nil(err)
+	err = user.Payment(ctx, testTransfer(user, "0.0001"))
+	assert.Nil(err)
+	refunds, err = PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 1)
+	assert.Equal(over.SnapshotId, refunds[0].SnapshotId)
+	assert.Equal(RefundReasonOverpaid, refunds[0].Reason)
+	assert.Equal(user.UserId, refunds[0].UserId)
+
+	matched := testTransfer(user, "0.1")
+	err = user.Payment(ctx, matched)
+	assert.Nil(err)
+	err = CreateRefund(ctx, matched.SnapshotId, user.UserId, matched.AssetId, matched.Amount, RefundReasonUntraced)
+	assert.Nil(err)
+	snapshotId := bot.UuidNewV4().String()
+	err = CreateRefund(ctx, snapshotId, user.UserId, testPaymentAssetId, "1", RefundReasonUntraced)
+	assert.Nil(err)
+	err = CreateRefund(ctx, snapshotId, user.UserId, testPaymentAssetId, "1", RefundReasonUntraced)
+	assert.Nil(err)
+	err = CreateRefund(ctx, bot.UuidNewV4().String(), user.UserId, testPaymentAssetId, "1", RefundReasonPacket)
+	assert.Nil(err)
+	refunds, err = PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 2)
+
+	err = UpdateRefund(ctx, snapshotId)
+	assert.Nil(err)
+	refunds, err = PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 1)
+
+	refunds, err = user.ReadRefunds(ctx, genesisStartedAt())
+	assert.NotNil(err)
+	refunds, err = admin.ReadRefunds(ctx, genesisStartedAt())
+	assert.Nil(err)
+	assert.Len(refunds, 0)
+	refunds, err = admin.ReadRefunds(ctx, time.Time{})
+	assert.Nil(err)
+	assert.Len(refunds, 2)
+
+	id, err := generateRefundId(snapshotId)
+	assert.Nil(err)
+	packetRefundId, err := generatePacketRefundId(snapshotId)
+	assert.Nil(err)
+	assert.NotEqual(packetRefundId, id)
+}
@@ -144,17 +144,14 @@ func SendRewardTransfer(ctx context.Context, reward *Reward) error {
 		return err
 	}
 	memo := fmt.Sprintf(config.AppConfig.MessageTemplate.MessageRewardMemo, user.FullName)
-	if len(memo) > 140 {
-		memo = memo[:120]
-	}
 	in := &bot.TransferInput{
 		AssetId:     reward.AssetId,
 		RecipientId: reward.RecipientId,
 		Amount:      number.FromString(reward.Amount),
 		TraceId:     traceId,
-		Memo:        memo,
+		Memo:        transferMemo(memo),
 	}
-	err = bot.CreateTransfer(ctx, in, config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey, config.AppConfig.Mixin.SessionAssetPIN, config.AppConfig.Mixin.PinToken)
+	err = session.Transport(ctx).CreateTransfer(ctx, in)
 	if err != nil {
 		return session.ServerError(ctx, err)
 	}
@@ -0,0 +1,361 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	RoleOwner       = "owner"
+	RoleAdmin       = "admin"
+	RoleModerator   = "moderator"
+	RoleWhitelisted = "whitelisted"
+	RoleUser        = "user"
+
+	PermissionBan           = "ban"
+	PermissionKick          = "kick"
+	PermissionMute          = "mute"
+	PermissionDeleteMessage = "delete_message"
+	PermissionReview        = "review"
+	PermissionProperty      = "property"
+	PermissionBroadcaster   = "broadcaster"
+	PermissionSchedule      = "schedule"
+	PermissionAudit         = "audit"
+	PermissionRefund        = "refund"
+	PermissionPayment       = "payment"
+	PermissionInvite        = "invite"
+	PermissionDelivery      = "delivery"
+
+	RolesCacheTTL = time.Minute
+)
+
+var permissions = map[string]bool{
+	PermissionBan:           true,
+	PermissionKick:          true,
+	PermissionMute:          true,
+	PermissionDeleteMessage: true,
+	PermissionReview:        true,
+	PermissionProperty:      true,
+	PermissionBroadcaster:   true,
+	PermissionSchedule:      true,
+	PermissionAudit:         true,
+	PermissionRefund:        true,
+	PermissionPayment:       true,
+	PermissionInvite:        true,
+	PermissionDelivery:      true,
+}
+
+var defaultModeratorPermissions = []string{PermissionDeleteMessage, PermissionMute, PermissionReview}
+
+var roleRanks = map[string]int{
+	RoleUser:        0,
+	RoleWhitelisted: 1,
+	RoleModerator:   2,
+	RoleAdmin:       3,
+	RoleOwner:       4,
+}
+
+const roles_DDL = `
+CREATE TABLE IF NOT EXISTS roles (
+	user_id            VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	role               VARCHAR(128) NOT NULL,
+	granted_by         VARCHAR(36) NOT NULL CHECK (granted_by ~* '^[0-9a-f-]{36,36}$'),
+	permissions        VARCHAR(1024) NOT NULL DEFAULT '',
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS roles_role_updatedx ON roles(role, updated_at);
+`
+
+var rolesCols = []string{"user_id", "role", "granted_by", "permissions", "created_at", "updated_at"}
+
+func (r *Role) values() []interface{} {
+	return []interface{}{r.UserId, r.Role, r.GrantedBy, strings.Join(r.Permissions, ","), r.CreatedAt, r.UpdatedAt}
+}
+
+func roleFromRow(row durable.Row) (*Role, error) {
+	var r Role
+	var permissions string
+	err := row.Scan(&r.UserId, &r.Role, &r.GrantedBy, &permissions, &r.CreatedAt, &r.UpdatedAt)
+	if permissions != "" {
+		r.Permissions = strings.Split(permissions, ",")
+	}
+	return &r, err
+}
+
+type Role struct {
+	UserId      string
+	Role        string
+	GrantedBy   string
+	Permissions []string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	FullName       string
+	IdentityNumber int64
+}
+
+// roles caches the whole roles table, it's small and read by every request
+// and message, both the http and message services reload it periodically.
+var roles = struct {
+	sync.RWMutex
+	users    map[string]*Role
+	loadedAt time.Time
+}{users: make(map[string]*Role)}
+
+func LoadRoles(ctx context.Context) error {
+	query := fmt.Sprintf("SELECT %s FROM roles", strings.Join(rolesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	users := make(map[string]*Role)
+	for rows.Next() {
+		r, err := roleFromRow(rows)
+		if err != nil {
+			return session.TransactionError(ctx, err)
+		}
+		users[r.UserId] = r
+	}
+	if err := rows.Err(); err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	roles.Lock()
+	roles.users = users
+	roles.loadedAt = time.Now()
+	roles.Unlock()
+	return nil
+}
+
+// RefreshRoles only hits the database when the cache is older than RolesCacheTTL.
+func RefreshRoles(ctx context.Context) error {
+	roles.RLock()
+	loadedAt := roles.loadedAt
+	roles.RUnlock()
+	if time.Since(loadedAt) < RolesCacheTTL {
+		return nil
+	}
+	return LoadRoles(ctx)
+}
+
+// UserRole prefers the operator_list and white_list in config.yaml, so the
+// group can never lose its owners because of a bad grant.
+func UserRole(userId string) string {
+	if config.AppConfig.System.Operators[userId] {
+		return RoleOwner
+	}
+	roles.RLock()
+	r := roles.users[userId]
+	roles.RUnlock()
+	if r != nil {
+		return r.Role
+	}
+	if config.AppConfig.System.WhiteMap[userId] {
+		return RoleWhitelisted
+	}
+	return RoleUser
+}
+
+// reviewerIds lists the owners in config.yaml, and the admins and moderators
+// in the roles cache holding the review permission.
+func reviewerIds() []string {
+	ids := make([]string, 0)
+	for id := range config.AppConfig.System.Operators {
+		ids = append(ids, id)
+	}
+	roles.RLock()
+	granted := make([]string, 0, len(roles.users))
+	for id := range roles.users {
+		granted = append(granted, id)
+	}
+	roles.RUnlock()
+	for _, id := range granted {
+		if config.AppConfig.System.Operators[id] {
+			continue
+		}
+		if (&User{UserId: id}).Can(PermissionReview) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func isOperatorRole(role string) bool {
+	return roleRanks[role] >= roleRanks[RoleModerator]
+}
+
+// Can tells whether the user holds the permission, owners and admins hold all
+// of them, a moderator holds the ones granted to it, or the defaults in
+// moderator_permissions when none granted.
+func (user *User) Can(permission string) bool {
+	switch user.GetRole() {
+	case RoleOwner, RoleAdmin:
+		return true
+	case RoleModerator:
+	default:
+		return false
+	}
+	roles.RLock()
+	r := roles.users[user.UserId]
+	roles.RUnlock()
+	granted := defaultModeratorPermissions
+	if len(config.AppConfig.System.ModeratorPermissions) > 0 {
+		granted = config.AppConfig.System.ModeratorPermissions
+	}
+	if r != nil && len(r.Permissions) > 0 {
+		granted = r.Permissions
+	}
+	for _, p := range granted {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantRole lets owners grant any role, while admins could only grant the
+// roles below them to users below them. The permissions only apply to
+// moderators, empty means the default ones.
+func (current *User) GrantRole(ctx context.Context, userId, role string, grants []string) (*Role, error) {
+	if _, err := bot.UuidFromString(userId); err != nil {
+		return nil, session.BadDataError(ctx)
+	}
+	if _, found := roleRanks[role]; !found || role == RoleUser {
+		return nil, session.BadDataError(ctx)
+	}
+	if role != RoleModerator && len(grants) > 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	for _, p := range grants {
+		if !permissions[p] {
+			return nil, session.BadDataError(ctx)
+		}
+	}
+	if !current.canManageRole(userId, role) {
+		return nil, session.ForbiddenError(ctx)
+	}
+
+	t := time.Now()
+	r := &Role{
+		UserId:      userId,
+		Role:        role,
+		GrantedBy:   current.UserId,
+		Permissions: grants,
+		CreatedAt:   t,
+		UpdatedAt:   t,
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		u, err := findUserById(ctx, tx, userId)
+		if err != nil || u == nil {
+			r = nil
+			return err
+		}
+		r.FullName, r.IdentityNumber = u.FullName, u.IdentityNumber
+		params, positions := compileTableQuery(rolesCols)
+		query := fmt.Sprintf("INSERT INTO roles (%s) VALUES (%s) ON CONFLICT (user_id) DO UPDATE SET (role,granted_by,permissions,updated_at)=(EXCLUDED.role,EXCLUDED.granted_by,EXCLUDED.permissions,EXCLUDED.updated_at)", params, positions)
+		_, err = tx.ExecContext(ctx, query, r.values()...)
+		if err != nil {
+			return err
+		}
+		detail := role
+		if len(grants) > 0 {
+			detail = fmt.Sprintf("%s %s", role, strings.Join(grants, ","))
+		}
+		return createAuditLogInTx(ctx, tx, current.UserId, AuditActionGrantRole, userId, detail)
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	if r == nil {
+		return nil, session.NotFoundError(ctx)
+	}
+	roles.Lock()
+	roles.users[userId] = r
+	roles.Unlock()
+	return r, nil
+}
+
+func (current *User) RevokeRole(ctx context.Context, userId string) error {
+	if !current.canManageRole(userId, RoleUser) {
+		return session.ForbiddenError(ctx)
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		r, err := tx.ExecContext(ctx, "DELETE FROM roles WHERE user_id=$1", userId)
+		if err != nil {
+			return err
+		}
+		if count, err := r.RowsAffected(); err != nil || count == 0 {
+			return err
+		}
+		return createAuditLogInTx(ctx, tx, current.UserId, AuditActionRevokeRole, userId, "")
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	roles.Lock()
+	delete(roles.users, userId)
+	roles.Unlock()
+	return nil
+}
+
+func (current *User) ReadRoles(ctx context.Context) ([]*Role, error) {
+	if roleRanks[current.GetRole()] < roleRanks[RoleAdmin] {
+		return nil, session.ForbiddenError(ctx)
+	}
+	cols := make([]string, len(rolesCols))
+	for i, c := range rolesCols {
+		cols[i] = "roles." + c
+	}
+	query := fmt.Sprintf("SELECT %s,users.full_name,users.identity_number FROM roles LEFT JOIN users ON roles.user_id=users.user_id ORDER BY roles.updated_at DESC", strings.Join(cols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var list []*Role
+	for rows.Next() {
+		var r Role
+		var grants string
+		var fullName sql.NullString
+		var identity sql.NullInt64
+		err := rows.Scan(&r.UserId, &r.Role, &r.GrantedBy, &grants, &r.CreatedAt, &r.UpdatedAt, &fullName, &identity)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		if grants != "" {
+			r.Permissions = strings.Split(grants, ",")
+		}
+		r.FullName, r.IdentityNumber = fullName.String, identity.Int64
+		list = append(list, &r)
+	}
+	return list, nil
+}
+
+// canManageRole checks both the role to grant and the role the user holds now,
+// the owners from config.yaml could never be changed.
+func (current *User) canManageRole(userId, role string) bool {
+	if config.AppConfig.System.Operators[userId] || userId == current.UserId {
+		return false
+	}
+	rank := roleRanks[current.GetRole()]
+	if rank < roleRanks[RoleAdmin] {
+		return false
+	}
+	if rank == roleRanks[RoleOwner] {
+		return true
+	}
+	return roleRanks[role] < rank && roleRanks[UserRole(userId)] < rank
+}
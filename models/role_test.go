@@ -0,0 +1,141 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	owner, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "owner", "http://localhost")
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	wang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "Wang", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{owner.UserId: true}
+	config.AppConfig.System.WhiteMap = map[string]bool{}
+
+	assert.Equal(RoleOwner, owner.GetRole())
+	assert.Equal(RoleUser, li.GetRole())
+	assert.False(li.IsOperator())
+
+	role, err := li.GrantRole(ctx, wang.UserId, RoleModerator, nil)
+	assert.NotNil(err)
+	assert.Nil(role)
+	role, err = owner.GrantRole(ctx, li.UserId, RoleUser, nil)
+	assert.NotNil(err)
+	role, err = owner.GrantRole(ctx, li.UserId, RoleAdmin, nil)
+	assert.Nil(err)
+	assert.NotNil(role)
+	assert.Equal("Li", role.FullName)
+	assert.Equal(RoleAdmin, li.GetRole())
+	assert.True(li.IsOperator())
+
+	role, err = li.GrantRole(ctx, wang.UserId, RoleAdmin, nil)
+	assert.NotNil(err)
+	role, err = li.GrantRole(ctx, wang.UserId, RoleModerator, nil)
+	assert.Nil(err)
+	assert.Equal(RoleModerator, wang.GetRole())
+	assert.True(wang.IsOperator())
+	assert.False(wang.isWhiteList())
+	err = wang.RevokeRole(ctx, li.UserId)
+	assert.NotNil(err)
+	err = li.RevokeRole(ctx, owner.UserId)
+	assert.NotNil(err)
+
+	roles, err := wang.ReadRoles(ctx)
+	assert.NotNil(err)
+	assert.Nil(roles)
+	roles, err = li.ReadRoles(ctx)
+	assert.Nil(err)
+	assert.Len(roles, 2)
+	err = LoadRoles(ctx)
+	assert.Nil(err)
+	assert.Equal(RoleModerator, wang.GetRole())
+
+	role, err = li.GrantRole(ctx, wang.UserId, RoleWhitelisted, nil)
+	assert.Nil(err)
+	assert.True(wang.isWhiteList())
+	assert.False(wang.IsOperator())
+	err = li.RevokeRole(ctx, wang.UserId)
+	assert.Nil(err)
+	assert.Equal(RoleUser, wang.GetRole())
+	err = owner.RevokeRole(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Equal(RoleUser, li.GetRole())
+	roles, err = owner.ReadRoles(ctx)
+	assert.Nil(err)
+	assert.Len(roles, 0)
+}
+
+func TestRolePermissions(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	owner, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "owner", "http://localhost")
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	wang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "Wang", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{owner.UserId: true}
+	config.AppConfig.System.ModeratorPermissions = nil
+
+	assert.True(owner.Can(PermissionRefund))
+	assert.False(li.Can(PermissionMute))
+	_, err = owner.GrantRole(ctx, li.UserId, RoleAdmin, []string{PermissionMute})
+	assert.NotNil(err)
+	_, err = owner.GrantRole(ctx, li.UserId, RoleModerator, []string{"unknown"})
+	assert.NotNil(err)
+	_, err = owner.GrantRole(ctx, li.UserId, RoleModerator, nil)
+	assert.Nil(err)
+	assert.True(li.Can(PermissionMute))
+	assert.True(li.Can(PermissionDeleteMessage))
+	assert.False(li.Can(PermissionProperty))
+	assert.False(li.Can(PermissionBan))
+	_, err = li.CreateProperty(ctx, ProhibitedMessage, true)
+	assert.NotNil(err)
+	b, err := li.CreateBlacklist(ctx, wang.UserId, "spam")
+	assert.Nil(err)
+	assert.Nil(b)
+
+	config.AppConfig.System.ModeratorPermissions = []string{PermissionBan}
+	assert.True(li.Can(PermissionBan))
+	assert.False(li.Can(PermissionMute))
+	role, err := owner.GrantRole(ctx, li.UserId, RoleModerator, []string{PermissionProperty})
+	assert.Nil(err)
+	assert.Equal([]string{PermissionProperty}, role.Permissions)
+	err = LoadRoles(ctx)
+	assert.Nil(err)
+	assert.True(li.Can(PermissionProperty))
+	assert.False(li.Can(PermissionBan))
+	_, err = li.CreateProperty(ctx, ProhibitedMessage, true)
+	assert.Nil(err)
+	s, err := ReadStatistic(ctx, li)
+	assert.Nil(err)
+	assert.Equal(true, s["prohibited"])
+	s, err = ReadStatistic(ctx, wang)
+	assert.Nil(err)
+	assert.Equal(false, s["prohibited"])
+
+	_, err = owner.GrantRole(ctx, wang.UserId, RoleModerator, nil)
+	assert.Nil(err)
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, wang, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.Nil(message)
+	message, err = CreateMessage(ctx, owner, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	config.AppConfig.System.ModeratorPermissions = nil
+}
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	ScheduleStatePending   = "pending"
+	ScheduleStateCancelled = "cancelled"
+	ScheduleStateFinished  = "finished"
+)
+
+const scheduled_messages_DDL = `
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+	schedule_id        VARCHAR(36) PRIMARY KEY CHECK (schedule_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	category           VARCHAR(512) NOT NULL,
+	data               TEXT NOT NULL,
+	recurrence         VARCHAR(128) NOT NULL DEFAULT '',
+	next_at            TIMESTAMP WITH TIME ZONE NOT NULL,
+	state              VARCHAR(128) NOT NULL,
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_messages_state_nextx ON scheduled_messages(state, next_at);
+`
+
+var scheduledMessagesCols = []string{"schedule_id", "user_id", "category", "data", "recurrence", "next_at", "state", "created_at", "updated_at"}
+
+func (s *ScheduledMessage) values() []interface{} {
+	return []interface{}{s.ScheduleId, s.UserId, s.Category, s.Data, s.Recurrence, s.NextAt, s.State, s.CreatedAt, s.UpdatedAt}
+}
+
+func scheduledMessageFromRow(row durable.Row) (*ScheduledMessage, error) {
+	var s ScheduledMessage
+	err := row.Scan(&s.ScheduleId, &s.UserId, &s.Category, &s.Data, &s.Recurrence, &s.NextAt, &s.State, &s.CreatedAt, &s.UpdatedAt)
+	return &s, err
+}
+
+type ScheduledMessage struct {
+	ScheduleId string
+	UserId     string
+	Category   string
+	Data       string
+	Recurrence string
+	NextAt     time.Time
+	State      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (current *User) CreateScheduledMessage(ctx context.Context, category, data, recurrence string, scheduledAt time.Time) (*ScheduledMessage, error) {
+	if !current.Can(PermissionSchedule) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	t := time.Now()
+	s := &ScheduledMessage{
+		ScheduleId: bot.UuidNewV4().String(),
+		UserId:     current.UserId,
+		State:      ScheduleStatePending,
+		CreatedAt:  t,
+		UpdatedAt:  t,
+	}
+	err := s.assign(ctx, category, data, recurrence, scheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	params, positions := compileTableQuery(scheduledMessagesCols)
+	query := fmt.Sprintf("INSERT INTO scheduled_messages (%s) VALUES (%s)", params, positions)
+	_, err = session.Database(ctx).ExecContext(ctx, query, s.values()...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+func (current *User) UpdateScheduledMessage(ctx context.Context, id, category, data, recurrence string, scheduledAt time.Time) (*ScheduledMessage, error) {
+	if !current.Can(PermissionSchedule) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	s, err := FindScheduledMessage(ctx, id)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	if s.State != ScheduleStatePending {
+		return nil, session.ForbiddenError(ctx)
+	}
+	err = s.assign(ctx, category, data, recurrence, scheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	s.UpdatedAt = time.Now()
+	query := "UPDATE scheduled_messages SET (category,data,recurrence,next_at,updated_at)=($1,$2,$3,$4,$5) WHERE schedule_id=$6 AND state=$7"
+	_, err = session.Database(ctx).ExecContext(ctx, query, s.Category, s.Data, s.Recurrence, s.NextAt, s.UpdatedAt, s.ScheduleId, ScheduleStatePending)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+func (current *User) CancelScheduledMessage(ctx context.Context, id string) (*ScheduledMessage, error) {
+	if !current.Can(PermissionSchedule) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	s, err := FindScheduledMessage(ctx, id)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	if s.State != ScheduleStatePending {
+		return s, nil
+	}
+	s.State = ScheduleStateCancelled
+	s.UpdatedAt = time.Now()
+	query := "UPDATE scheduled_messages SET (state,updated_at)=($1,$2) WHERE schedule_id=$3"
+	_, err = session.Database(ctx).ExecContext(ctx, query, s.State, s.UpdatedAt, s.ScheduleId)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+func (current *User) ListScheduledMessages(ctx context.Context) ([]*ScheduledMessage, error) {
+	if !current.Can(PermissionSchedule) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	query := fmt.Sprintf("SELECT %s FROM scheduled_messages ORDER BY state DESC,next_at LIMIT 200", strings.Join(scheduledMessagesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var schedules []*ScheduledMessage
+	for rows.Next() {
+		s, err := scheduledMessageFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+func FindScheduledMessage(ctx context.Context, id string) (*ScheduledMessage, error) {
+	query := fmt.Sprintf("SELECT %s FROM scheduled_messages WHERE schedule_id=$1", strings.Join(scheduledMessagesCols, ","))
+	s, err := scheduledMessageFromRow(session.Database(ctx).QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+func DueScheduledMessages(ctx context.Context, limit int) ([]*ScheduledMessage, error) {
+	query := fmt.Sprintf("SELECT %s FROM scheduled_messages WHERE state=$1 AND next_at<=$2 ORDER BY state,next_at LIMIT %d", strings.Join(scheduledMessagesCols, ","), limit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, ScheduleStatePending, time.Now())
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var schedules []*ScheduledMessage
+	for rows.Next() {
+		s, err := scheduledMessageFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// Publish inserts the due occurrence into messages and moves the schedule to
+// its next occurrence, the message id is derived from the occurrence so a
+// retry never posts the same announcement twice. The schedule is read again
+// in the transaction, so an edit after it's due is published as edited.
+func (s *ScheduledMessage) Publish(ctx context.Context) error {
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM scheduled_messages WHERE schedule_id=$1 FOR UPDATE", strings.Join(scheduledMessagesCols, ","))
+		schedule, err := scheduledMessageFromRow(tx.QueryRowContext(ctx, query, s.ScheduleId))
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		t := time.Now()
+		if schedule.State != ScheduleStatePending || schedule.NextAt.After(t) {
+			*s = *schedule
+			return nil
+		}
+		messageId, err := generateScheduledMessageId(schedule.ScheduleId, schedule.NextAt)
+		if err != nil {
+			return err
+		}
+		message := &Message{
+			MessageId:        messageId,
+			UserId:           schedule.UserId,
+			Category:         schedule.Category,
+			Data:             schedule.Data,
+			CreatedAt:        t,
+			UpdatedAt:        t,
+			State:            MessageStatePending,
+			LastDistributeAt: genesisStartedAt(),
+		}
+		params, positions := compileTableQuery(messagesCols)
+		query = fmt.Sprintf("INSERT INTO messages (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", params, positions)
+		_, err = tx.ExecContext(ctx, query, message.values()...)
+		if err != nil {
+			return err
+		}
+
+		schedule.State = ScheduleStateFinished
+		if schedule.Recurrence != "" {
+			cron, err := parseCron(schedule.Recurrence)
+			if err != nil {
+				return err
+			}
+			if next := cron.next(t); !next.IsZero() {
+				schedule.NextAt = next
+				schedule.State = ScheduleStatePending
+			}
+		}
+		schedule.UpdatedAt = t
+		_, err = tx.ExecContext(ctx, "UPDATE scheduled_messages SET (next_at,state,updated_at)=($1,$2,$3) WHERE schedule_id=$4", schedule.NextAt, schedule.State, schedule.UpdatedAt, schedule.ScheduleId)
+		if err != nil {
+			return err
+		}
+		*s = *schedule
+		return nil
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (s *ScheduledMessage) assign(ctx context.Context, category, data, recurrence string, scheduledAt time.Time) error {
+	switch category {
+	case MessageCategoryPlainText,
+		MessageCategoryPlainImage,
+		MessageCategoryAppCard,
+		MessageCategoryAppButtonGroup:
+	default:
+		return session.BadDataError(ctx)
+	}
+	if len(data) == 0 || len(data) > 5*1024 {
+		return session.BadDataError(ctx)
+	}
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return session.BadDataError(ctx)
+	}
+	recurrence = strings.TrimSpace(recurrence)
+	if len(recurrence) > 128 {
+		return session.BadDataError(ctx)
+	}
+	if scheduledAt.IsZero() {
+		if recurrence == "" {
+			return session.BadDataError(ctx)
+		}
+		cron, err := parseCron(recurrence)
+		if err != nil {
+			return session.BadDataError(ctx)
+		}
+		scheduledAt = cron.next(time.Now())
+		if scheduledAt.IsZero() {
+			return session.BadDataError(ctx)
+		}
+	} else if recurrence != "" {
+		if _, err := parseCron(recurrence); err != nil {
+			return session.BadDataError(ctx)
+		}
+	}
+	s.Category = category
+	s.Data = data
+	s.Recurrence = recurrence
+	s.NextAt = scheduledAt
+	return nil
+}
+
+func generateScheduledMessageId(scheduleId string, at time.Time) (string, error) {
+	h := md5.New()
+	io.WriteString(h, scheduleId)
+	io.WriteString(h, fmt.Sprint(at.Unix()))
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x30
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	id, err := uuid.FromBytes(sum)
+	return id.String(), err
+}
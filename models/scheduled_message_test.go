@@ -0,0 +1,160 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduledMessageCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "admin", "http://localhost")
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+
+	data := base64.StdEncoding.EncodeToString([]byte("daily news"))
+	s, err := li.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, "", time.Now())
+	assert.NotNil(err)
+	assert.Nil(s)
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, "", time.Time{})
+	assert.NotNil(err)
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, "61 * * * *", time.Now())
+	assert.NotNil(err)
+
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, "", time.Now().Add(-time.Minute))
+	assert.Nil(err)
+	assert.NotNil(s)
+	once := s.ScheduleId
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, "@daily", time.Time{})
+	assert.Nil(err)
+	assert.NotNil(s)
+	assert.True(s.NextAt.After(time.Now()))
+	daily := s.ScheduleId
+
+	schedules, err := DueScheduledMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(schedules, 1)
+	assert.Equal(once, schedules[0].ScheduleId)
+	err = schedules[0].Publish(ctx)
+	assert.Nil(err)
+	err = schedules[0].Publish(ctx)
+	assert.Nil(err)
+	s, err = FindScheduledMessage(ctx, once)
+	assert.Nil(err)
+	assert.Equal(ScheduleStateFinished, s.State)
+	messages, err := PendingMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.Equal(admin.UserId, messages[0].UserId)
+
+	s, err = admin.UpdateScheduledMessage(ctx, daily, MessageCategoryPlainText, data, "*/10 * * * *", time.Now().Add(-time.Minute))
+	assert.Nil(err)
+	assert.Equal("*/10 * * * *", s.Recurrence)
+	schedules, err = DueScheduledMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(schedules, 1)
+	err = schedules[0].Publish(ctx)
+	assert.Nil(err)
+	s, err = FindScheduledMessage(ctx, daily)
+	assert.Nil(err)
+	assert.Equal(ScheduleStatePending, s.State)
+	assert.True(s.NextAt.After(time.Now()))
+	assert.Equal(0, s.NextAt.Minute()%10)
+
+	s, err = admin.CancelScheduledMessage(ctx, daily)
+	assert.Nil(err)
+	assert.Equal(ScheduleStateCancelled, s.State)
+	s, err = admin.UpdateScheduledMessage(ctx, daily, MessageCategoryPlainText, data, "", time.Now())
+	assert.NotNil(err)
+	schedules, err = admin.ListScheduledMessages(ctx)
+	assert.Nil(err)
+	assert.Len(schedules, 2)
+	s, err = admin.CancelScheduledMessage(ctx, bot.UuidNewV4().String())
+	assert.Nil(err)
+	assert.Nil(s)
+}
+
+func TestScheduledMessagePublishEdited(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	admin, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "admin", "http://localhost")
+	assert.Nil(err)
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+
+	data := base64.StdEncoding.EncodeToString([]byte("daily news"))
+	s, err := admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, "", time.Now().Add(-time.Minute))
+	assert.Nil(err)
+	schedules, err := DueScheduledMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(schedules, 1)
+
+	edited := base64.StdEncoding.EncodeToString([]byte("edited news"))
+	_, err = admin.UpdateScheduledMessage(ctx, s.ScheduleId, MessageCategoryPlainText, edited, "", time.Now().Add(-time.Second))
+	assert.Nil(err)
+	err = schedules[0].Publish(ctx)
+	assert.Nil(err)
+	assert.Equal(edited, schedules[0].Data)
+	assert.Equal(ScheduleStateFinished, schedules[0].State)
+	messages, err := PendingMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.Equal(edited, messages[0].Data)
+
+	s, err = admin.CreateScheduledMessage(ctx, MessageCategoryPlainText, data, "", time.Now().Add(-time.Minute))
+	assert.Nil(err)
+	schedules, err = DueScheduledMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(schedules, 1)
+	_, err = admin.UpdateScheduledMessage(ctx, s.ScheduleId, MessageCategoryPlainText, edited, "", time.Now().Add(time.Hour))
+	assert.Nil(err)
+	err = schedules[0].Publish(ctx)
+	assert.Nil(err)
+	s, err = FindScheduledMessage(ctx, s.ScheduleId)
+	assert.Nil(err)
+	assert.Equal(ScheduleStatePending, s.State)
+	assert.True(s.NextAt.After(time.Now()))
+	messages, err = PendingMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(messages, 1)
+}
+
+func TestParseCron(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2019, 11, 5, 10, 30, 20, 0, time.UTC)
+	cron, err := parseCron("0 9 * * 1-5")
+	assert.Nil(err)
+	assert.Equal(time.Date(2019, 11, 6, 9, 0, 0, 0, time.UTC), cron.next(base))
+	cron, err = parseCron("*/15 * * * *")
+	assert.Nil(err)
+	assert.Equal(time.Date(2019, 11, 5, 10, 45, 0, 0, time.UTC), cron.next(base))
+	cron, err = parseCron("@monthly")
+	assert.Nil(err)
+	assert.Equal(time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC), cron.next(base))
+	cron, err = parseCron("0 0 * * 7")
+	assert.Nil(err)
+	assert.Equal(time.Date(2019, 11, 10, 0, 0, 0, 0, time.UTC), cron.next(base))
+	cron, err = parseCron("0 0 30 2 *")
+	assert.Nil(err)
+	assert.True(cron.next(base).IsZero())
+
+	_, err = parseCron("* * * *")
+	assert.NotNil(err)
+	_, err = parseCron("0 24 * * *")
+	assert.NotNil(err)
+	_, err = parseCron("5-1 * * * *")
+	assert.NotNil(err)
+	_, err = parseCron("*/0 * * * *")
+	assert.NotNil(err)
+}
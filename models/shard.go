@@ -0,0 +1,245 @@
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	MessageShardSizeProperty = "message-shard-size-property"
+	MessageShardMaxSize      = 256
+	ShardMigrationLimit      = 500
+
+	messageShardSizeCacheTTL = 10 * time.Second
+)
+
+var messageShardSizeCache struct {
+	sync.Mutex
+	size   int64
+	readAt time.Time
+}
+
+// MessageShard is a shard of the distributed messages, the index is -1 for
+// the shards removed by resizing but still holding pending messages.
+type MessageShard struct {
+	ShardId   string
+	Index     int64
+	OwnerId   string
+	ExpiredAt time.Time
+	Pending   int64
+}
+
+// messageShardSize reads the size resized online, or the message_shard_size
+// in config.yaml clamped to 1..MessageShardMaxSize, it's cached for a few
+// seconds, the messages written with a stale size are moved by
+// MigrateDistributedMessages.
+func messageShardSize(ctx context.Context) (int64, error) {
+	messageShardSizeCache.Lock()
+	defer messageShardSizeCache.Unlock()
+	if messageShardSizeCache.size > 0 && time.Since(messageShardSizeCache.readAt) < messageShardSizeCacheTTL {
+		return messageShardSizeCache.size, nil
+	}
+	size := config.AppConfig.System.MessageShardSize
+	p, err := ReadProperty(ctx, MessageShardSizeProperty)
+	if err != nil {
+		return 0, err
+	}
+	if p != nil {
+		if n, err := strconv.ParseInt(p.Value, 10, 64); err == nil && n > 0 {
+			size = n
+		}
+	}
+	if size < 1 {
+		size = 1
+	} else if size > MessageShardMaxSize {
+		size = MessageShardMaxSize
+	}
+	messageShardSizeCache.size, messageShardSizeCache.readAt = size, time.Now()
+	return size, nil
+}
+
+func resetMessageShardSizeCache() {
+	messageShardSizeCache.Lock()
+	defer messageShardSizeCache.Unlock()
+	messageShardSizeCache.size = 0
+}
+
+// MessageShards lists the shard ids of the current size, ordered by index.
+func MessageShards(ctx context.Context) ([]string, error) {
+	size, err := messageShardSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return messageShardIds(size), nil
+}
+
+// AllMessageShards lists the shard ids of the maximum size, which cover the
+// shards of any size.
+func AllMessageShards() []string {
+	return messageShardIds(MessageShardMaxSize)
+}
+
+func messageShardIds(size int64) []string {
+	shards := make([]string, size)
+	for i := range shards {
+		shards[i] = messageShardId(big.NewInt(int64(i)))
+	}
+	return shards
+}
+
+func messageShardId(i *big.Int) string {
+	h := md5.New()
+	h.Write([]byte(config.AppConfig.System.MessageShardModifier))
+	h.Write(i.Bytes())
+	s := h.Sum(nil)
+	s[6] = (s[6] & 0x0f) | 0x30
+	s[8] = (s[8] & 0x3f) | 0x80
+	id, err := uuid.FromBytes(s)
+	if err != nil {
+		panic(err)
+	}
+	return id.String()
+}
+
+// ResizeMessageShards takes effect in all message service processes after the
+// cache expires, the workers of the new shards are started by the rebalancing,
+// and the pending messages of the removed shards are migrated.
+func (current *User) ResizeMessageShards(ctx context.Context, size int64) error {
+	if !current.Can(PermissionProperty) {
+		return session.ForbiddenError(ctx)
+	}
+	if size < 1 || size > MessageShardMaxSize {
+		return session.BadDataError(ctx)
+	}
+	property := &Property{
+		Name:      MessageShardSizeProperty,
+		Value:     fmt.Sprint(size),
+		CreatedAt: time.Now(),
+	}
+	params, positions := compileTableQuery(propertiesColumns)
+	query := fmt.Sprintf("INSERT INTO properties (%s) VALUES (%s) ON CONFLICT (name) DO UPDATE SET value=EXCLUDED.value", params, positions)
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, property.values()...)
+		if err != nil {
+			return err
+		}
+		return createAuditLogInTx(ctx, tx, current.UserId, AuditActionProperty, property.Name, property.Value)
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	resetMessageShardSizeCache()
+	return nil
+}
+
+// ReadMessageShards lists the shards with their owners and pending messages,
+// including the removed shards not migrated yet.
+func (current *User) ReadMessageShards(ctx context.Context) ([]*MessageShard, error) {
+	if !current.Can(PermissionProperty) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	ids, err := MessageShards(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var shards []*MessageShard
+	byId := make(map[string]*MessageShard)
+	for i, id := range ids {
+		s := &MessageShard{ShardId: id, Index: int64(i)}
+		byId[id] = s
+		shards = append(shards, s)
+	}
+	all := AllMessageShards()
+	for i, id := range all[len(ids):] {
+		byId[id] = &MessageShard{ShardId: id, Index: int64(len(ids) + i)}
+	}
+
+	query := "SELECT shard,COUNT(*) FROM distributed_messages WHERE shard=ANY($1) AND status=$2 GROUP BY shard"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, pq.StringArray(all), MessageStatusSent)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		s := byId[id]
+		if s == nil {
+			continue
+		}
+		if s.Index >= int64(len(ids)) {
+			s.Index = -1
+			shards = append(shards, s)
+		}
+		s.Pending = count
+	}
+
+	leases, err := ReadLeases(ctx, LeasePrefixShard)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range leases {
+		if s := byId[strings.TrimPrefix(l.Name, LeasePrefixShard)]; s != nil {
+			s.OwnerId, s.ExpiredAt = l.OwnerId, l.ExpiredAt
+		}
+	}
+	return shards, nil
+}
+
+// MigrateDistributedMessages moves a batch of the pending messages out of the
+// shards removed by resizing, to the shards of the current size. A message is
+// only moved while pending, so it's never sent twice by the two shards.
+func MigrateDistributedMessages(ctx context.Context) (int, error) {
+	size, err := messageShardSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("SELECT message_id,conversation_id,recipient_id FROM distributed_messages WHERE shard=ANY($1) AND status=$2 LIMIT %d", ShardMigrationLimit)
+	removed := AllMessageShards()[size:]
+	rows, err := session.Database(ctx).QueryContext(ctx, query, pq.StringArray(removed), MessageStatusSent)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	moves := make(map[string][]string)
+	count := 0
+	for rows.Next() {
+		var id, conversationId, recipientId string
+		if err := rows.Scan(&id, &conversationId, &recipientId); err != nil {
+			return 0, session.TransactionError(ctx, err)
+		}
+		shard, err := shardId(ctx, conversationId, recipientId)
+		if err != nil {
+			return 0, session.ServerError(ctx, err)
+		}
+		moves[shard] = append(moves[shard], id)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	for shard, ids := range moves {
+		query := "UPDATE distributed_messages SET shard=$1 WHERE message_id=ANY($2) AND status=$3"
+		_, err := session.Database(ctx).ExecContext(ctx, query, shard, pq.StringArray(ids), MessageStatusSent)
+		if err != nil {
+			return 0, session.TransactionError(ctx, err)
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageShards(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	size := config.AppConfig.System.MessageShardSize
+	shards, err := MessageShards(ctx)
+	assert.Nil(err)
+	assert.Len(shards, int(size))
+	for i, shard := range shards {
+		assert.Equal(testShardId(config.AppConfig.System.MessageShardModifier, int64(i)), shard)
+	}
+	assert.Equal(shards, AllMessageShards()[:size])
+
+	config.AppConfig.System.MessageShardSize = MessageShardMaxSize + 1
+	resetMessageShardSizeCache()
+	shards, err = MessageShards(ctx)
+	assert.Nil(err)
+	assert.Len(shards, MessageShardMaxSize)
+	n, err := MigrateDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Equal(0, n)
+	config.AppConfig.System.MessageShardSize = size
+	resetMessageShardSizeCache()
+
+	admin := &User{UserId: bot.UuidNewV4().String()}
+	config.AppConfig.System.Operators = map[string]bool{admin.UserId: true}
+	user := &User{UserId: bot.UuidNewV4().String()}
+	assert.NotNil(user.ResizeMessageShards(ctx, size+1))
+	assert.NotNil(admin.ResizeMessageShards(ctx, 0))
+	assert.NotNil(admin.ResizeMessageShards(ctx, MessageShardMaxSize+1))
+
+	err = admin.ResizeMessageShards(ctx, size+2)
+	assert.Nil(err)
+	shards, err = MessageShards(ctx)
+	assert.Nil(err)
+	assert.Len(shards, int(size+2))
+	dms := make([]*DistributedMessage, 4)
+	for i := range dms {
+		dm, err := createDistributeMessage(ctx, bot.UuidNewV4().String(), bot.UuidNewV4().String(), "", admin.UserId, bot.UuidNewV4().String(), MessageCategoryPlainText, "")
+		assert.Nil(err)
+		dm.Shard = shards[size+int64(i%2)]
+		params, positions := compileTableQuery(distributedMessagesCols)
+		query := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES (%s)", params, positions)
+		_, err = session.Database(ctx).ExecContext(ctx, query, dm.values()...)
+		assert.Nil(err)
+		dms[i] = dm
+	}
+	n, err = MigrateDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Equal(0, n)
+
+	err = admin.ResizeMessageShards(ctx, size)
+	assert.Nil(err)
+	list, err := admin.ReadMessageShards(ctx)
+	assert.Nil(err)
+	assert.Len(list, int(size+2))
+	assert.Equal(int64(-1), list[size].Index)
+	assert.Equal(int64(-1), list[size+1].Index)
+	assert.Equal(int64(4), list[size].Pending+list[size+1].Pending)
+	_, err = user.ReadMessageShards(ctx)
+	assert.NotNil(err)
+
+	n, err = MigrateDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Equal(4, n)
+	n, err = MigrateDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Equal(0, n)
+	messages, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(messages, 4)
+	for _, m := range messages {
+		shard, err := shardId(ctx, m.ConversationId, m.RecipientId)
+		assert.Nil(err)
+		assert.Equal(shard, m.Shard)
+	}
+	list, err = admin.ReadMessageShards(ctx)
+	assert.Nil(err)
+	assert.Len(list, int(size))
+}
@@ -12,7 +12,7 @@ func ReadStatistic(ctx context.Context, user *User) (map[string]interface{}, err
 	}
 	s["users_count"] = count
 	s["prohibited"] = false
-	if user != nil && user.isAdmin() {
+	if user != nil && user.Can(PermissionProperty) {
 		b, err := ReadProhibitedProperty(ctx)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	SubscriptionPlanMonthly  = "monthly"
+	SubscriptionPlanYearly   = "yearly"
+	SubscriptionPlanLifetime = "lifetime"
+)
+
+var subscriptionPlanDurations = map[string]time.Duration{
+	SubscriptionPlanMonthly:  30 * 24 * time.Hour,
+	SubscriptionPlanYearly:   365 * 24 * time.Hour,
+	SubscriptionPlanLifetime: 0,
+}
+
+// subscriptionExpiresAt returns the zero time for lifetime, which never expires.
+func subscriptionExpiresAt(plan string, start time.Time) time.Time {
+	d := subscriptionPlanDurations[plan]
+	if d == 0 {
+		return time.Time{}
+	}
+	return start.Add(d)
+}
+
+// renewInTx extends a paid membership from its current expiry, or from now if
+// it's already expired but not downgraded yet.
+func (user *User) renewInTx(ctx context.Context, tx *sql.Tx, plan string) error {
+	if user.ExpiresAt.IsZero() {
+		return nil
+	}
+	start := time.Now()
+	if user.ExpiresAt.After(start) {
+		start = user.ExpiresAt
+	}
+	user.Plan = plan
+	user.ExpiresAt = subscriptionExpiresAt(plan, start)
+	user.TraceId = bot.UuidNewV4().String()
+	_, err := tx.ExecContext(ctx, "UPDATE users SET (plan,expires_at,trace_id)=($1,$2,$3) WHERE user_id=$4", user.Plan, user.ExpiresAt, user.TraceId, user.UserId)
+	return err
+}
+
+// WarnExpiringSubscriptions notices the members expiring in the warning days,
+// the message id is derived from the expiry so each member is warned once.
+func WarnExpiringSubscriptions(ctx context.Context, limit int) (int, error) {
+	days := config.AppConfig.System.SubscriptionWarningDays
+	if days <= 0 || config.AppConfig.MessageTemplate.MessageTipsExpiring == "" {
+		return 0, nil
+	}
+	var count int
+	offset := time.Now()
+	for {
+		query := fmt.Sprintf("SELECT %s FROM users WHERE state=$1 AND expires_at>$2 AND expires_at<$3 ORDER BY state,expires_at LIMIT %d", strings.Join(usersCols, ","), limit)
+		users, err := findUsersByQuery(ctx, query, PaymentStatePaid, offset, time.Now().Add(time.Duration(days)*24*time.Hour))
+		if err != nil {
+			return count, err
+		}
+		for _, u := range users {
+			text := fmt.Sprintf(config.AppConfig.MessageTemplate.MessageTipsExpiring, u.ExpiresAt.Format("2006-01-02 15:04"))
+			messageId := UniqueConversationId(u.UserId, "EXPIRING:"+u.ExpiresAt.Format(time.RFC3339Nano))
+			err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+				return createSubscriptionNoticeInTx(ctx, tx, u, messageId, text)
+			})
+			if err != nil {
+				return count, session.TransactionError(ctx, err)
+			}
+			offset = u.ExpiresAt
+		}
+		count += len(users)
+		if len(users) < limit {
+			return count, nil
+		}
+	}
+}
+
+// DowngradeExpiredSubscriptions puts the expired members back to pending and
+// unsubscribes them, they could renew through the same payment page.
+func DowngradeExpiredSubscriptions(ctx context.Context, limit int) (int, error) {
+	query := fmt.Sprintf("SELECT %s FROM users WHERE state=$1 AND expires_at>$2 AND expires_at<$3 ORDER BY state,expires_at LIMIT %d", strings.Join(usersCols, ","), limit)
+	users, err := findUsersByQuery(ctx, query, PaymentStatePaid, genesisStartedAt(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range users {
+		err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+			query := fmt.Sprintf("SELECT %s FROM users WHERE user_id=$1 FOR UPDATE", strings.Join(usersCols, ","))
+			user, err := userFromRow(tx.QueryRowContext(ctx, query, u.UserId))
+			if err == sql.ErrNoRows {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if user.State != PaymentStatePaid || user.ExpiresAt.IsZero() || user.ExpiresAt.After(time.Now()) {
+				return nil
+			}
+			messageId := UniqueConversationId(user.UserId, "EXPIRED:"+user.ExpiresAt.Format(time.RFC3339Nano))
+			err = createSubscriptionNoticeInTx(ctx, tx, user, messageId, config.AppConfig.MessageTemplate.MessageTipsExpired)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at)=($1,$2) WHERE user_id=$3", PaymentStatePending, time.Time{}, user.UserId)
+			return err
+		})
+		if err != nil {
+			return 0, session.TransactionError(ctx, err)
+		}
+	}
+	return len(users), nil
+}
+
+func createSubscriptionNoticeInTx(ctx context.Context, tx *sql.Tx, user *User, messageId, text string) error {
+	if text == "" {
+		return nil
+	}
+	data := base64.StdEncoding.EncodeToString([]byte(text))
+	dm, err := createDistributeMessage(ctx, messageId, messageId, "", config.AppConfig.Mixin.ClientId, user.UserId, MessageCategoryPlainText, data)
+	if err != nil {
+		return err
+	}
+	values := distributedMessageValuesString(dm.MessageId, dm.ConversationId, dm.RecipientId, dm.UserId, dm.ParentId, dm.QuoteMessageId, dm.Shard, dm.Category, dm.Data, dm.Status)
+	query := fmt.Sprintf("INSERT INTO distributed_messages (%s) VALUES %s ON CONFLICT (message_id) DO NOTHING", strings.Join(distributedMessagesCols, ","), values)
+	_, err = tx.ExecContext(ctx, query)
+	return err
+}
+
+func findUsersByQuery(ctx context.Context, query string, args ...interface{}) ([]*User, error) {
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u, err := userFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPaymentAssetId = "c94ac88f-4671-3976-b60a-09064f1811e8"
+
+var testPlanAmounts = map[string]string{
+	SubscriptionPlanMonthly:  "0.001",
+	SubscriptionPlanYearly:   "0.01",
+	SubscriptionPlanLifetime: "0.1",
+}
+
+func testPayment(ctx context.Context, user *User, plan string) error {
+	setupTestPlans()
+	return user.Payment(ctx, testTransfer(user, testPlanAmounts[plan]))
+}
+
+func setupTestPlans() {
+	config.AppConfig.System.SubscriptionPlans = nil
+	for name, amount := range testPlanAmounts {
+		config.AppConfig.System.SubscriptionPlans = append(config.AppConfig.System.SubscriptionPlans, config.SubscriptionPlan{
+			Name:   name,
+			Assets: []config.PaymentAsset{{Symbol: "XIN", AssetId: testPaymentAssetId, Amount: amount}},
+		})
+	}
+}
+
+func testTransfer(user *User, amount string) *Payment {
+	return &Payment{
+		SnapshotId: bot.UuidNewV4().String(),
+		TraceId:    user.TraceId,
+		AssetId:    testPaymentAssetId,
+		Amount:     amount,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func TestSubscriptionCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	traceId := user.TraceId
+
+	setupTestPlans()
+	err = user.Payment(ctx, testTransfer(user, "0.002"))
+	assert.Nil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, user.State)
+	assert.Equal(traceId, user.TraceId)
+
+	err = testPayment(ctx, user, SubscriptionPlanMonthly)
+	assert.Nil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.Equal(SubscriptionPlanMonthly, user.Plan)
+	assert.NotEqual(traceId, user.TraceId)
+	expiresAt := user.ExpiresAt
+	assert.True(expiresAt.After(time.Now().Add(29 * 24 * time.Hour)))
+
+	err = testPayment(ctx, user, SubscriptionPlanYearly)
+	assert.Nil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(SubscriptionPlanYearly, user.Plan)
+	assert.True(user.ExpiresAt.Sub(expiresAt) >= 365*24*time.Hour-time.Second)
+
+	config.AppConfig.System.SubscriptionWarningDays = 3
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE users SET expires_at=$1 WHERE user_id=$2", time.Now().Add(time.Hour), user.UserId)
+	assert.Nil(err)
+	count, err := WarnExpiringSubscriptions(ctx, 10)
+	assert.Nil(err)
+	assert.Equal(1, count)
+	count, err = DowngradeExpiredSubscriptions(ctx, 10)
+	assert.Nil(err)
+	assert.Equal(0, count)
+
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE users SET expires_at=$1 WHERE user_id=$2", time.Now().Add(-time.Hour), user.UserId)
+	assert.Nil(err)
+	count, err = DowngradeExpiredSubscriptions(ctx, 10)
+	assert.Nil(err)
+	assert.Equal(1, count)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, user.State)
+	dms, err := testReadDistributedMessages(ctx)
+	assert.Nil(err)
+	assert.Len(dms, 2)
+
+	err = testPayment(ctx, user, SubscriptionPlanLifetime)
+	assert.Nil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.True(user.ExpiresAt.IsZero())
+	count, err = DowngradeExpiredSubscriptions(ctx, 10)
+	assert.Nil(err)
+	assert.Equal(0, count)
+
+	config.AppConfig.System.RefundPolicy.Overpaid = true
+	defer func() { config.AppConfig.System.RefundPolicy.Overpaid = false }()
+	traceId = user.TraceId
+	payment := testTransfer(user, testPlanAmounts[SubscriptionPlanMonthly])
+	err = user.Payment(ctx, payment)
+	assert.Nil(err)
+	assert.Equal(PaymentResultOverpaid, payment.Result)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(SubscriptionPlanLifetime, user.Plan)
+	assert.True(user.ExpiresAt.IsZero())
+	assert.Equal(traceId, user.TraceId)
+	refunds, err := PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 1)
+	assert.Equal(payment.SnapshotId, refunds[0].SnapshotId)
+}
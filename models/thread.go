@@ -0,0 +1,202 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const threads_DDL = `
+CREATE TABLE IF NOT EXISTS threads (
+	thread_id          VARCHAR(36) PRIMARY KEY CHECK (thread_id ~* '^[0-9a-f-]{36,36}$'),
+	reply_count        BIGINT NOT NULL,
+	last_reply_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS threads_last_replyx ON threads(last_reply_at);
+
+CREATE TABLE IF NOT EXISTS thread_followers (
+	thread_id          VARCHAR(36) NOT NULL CHECK (thread_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY(thread_id, user_id)
+);
+`
+
+const ThreadMessagesLimit = 100
+
+var threadsCols = []string{"thread_id", "reply_count", "last_reply_at", "created_at"}
+
+func (t *Thread) values() []interface{} {
+	return []interface{}{t.ThreadId, t.ReplyCount, t.LastReplyAt, t.CreatedAt}
+}
+
+func threadFromRow(row durable.Row) (*Thread, error) {
+	var t Thread
+	err := row.Scan(&t.ThreadId, &t.ReplyCount, &t.LastReplyAt, &t.CreatedAt)
+	return &t, err
+}
+
+// Thread is keyed by its root message id, every reply to the root or to
+// any other reply in the thread carries the same thread_id in messages.
+type Thread struct {
+	ThreadId    string
+	ReplyCount  int64
+	LastReplyAt time.Time
+	CreatedAt   time.Time
+
+	Root     *Message
+	Replies  []*Message
+	Followed bool
+}
+
+func ShowThread(ctx context.Context, user *User, messageId string, offset time.Time) (*Thread, error) {
+	message, err := FindMessage(ctx, messageId)
+	if err != nil || message == nil {
+		return nil, err
+	}
+	threadId := message.MessageId
+	if message.ThreadId != "" {
+		threadId = message.ThreadId
+	}
+	root, err := findMessageWithUser(ctx, threadId)
+	if err != nil || root == nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM threads WHERE thread_id=$1", strings.Join(threadsCols, ","))
+	thread, err := threadFromRow(session.Database(ctx).QueryRowContext(ctx, query, threadId))
+	if err == sql.ErrNoRows {
+		thread = &Thread{ThreadId: threadId, LastReplyAt: root.CreatedAt, CreatedAt: root.CreatedAt}
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	thread.Root = root
+
+	query = "SELECT messages.message_id,messages.user_id,messages.category,messages.quote_message_id,messages.data,messages.created_at,users.full_name FROM messages LEFT JOIN users ON messages.user_id=users.user_id WHERE messages.thread_id=$1 AND messages.created_at>$2 ORDER BY messages.created_at LIMIT $3"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, threadId, offset, ThreadMessagesLimit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(&m.MessageId, &m.UserId, &m.Category, &m.QuoteMessageId, &m.Data, &m.CreatedAt, &m.FullName)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		m.ThreadId = threadId
+		decodeMessagePreview(&m)
+		thread.Replies = append(thread.Replies, &m)
+	}
+
+	followers, err := readThreadFollowers(ctx, threadId)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	thread.Followed = followers[user.UserId]
+	return thread, nil
+}
+
+func (user *User) FollowThread(ctx context.Context, messageId string) error {
+	message, err := FindMessage(ctx, messageId)
+	if err != nil || message == nil {
+		return err
+	}
+	threadId := message.MessageId
+	if message.ThreadId != "" {
+		threadId = message.ThreadId
+	}
+	query := "INSERT INTO thread_followers (thread_id,user_id,created_at) VALUES ($1,$2,$3) ON CONFLICT (thread_id,user_id) DO NOTHING"
+	_, err = session.Database(ctx).ExecContext(ctx, query, threadId, user.UserId, time.Now())
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func (user *User) UnfollowThread(ctx context.Context, messageId string) error {
+	message, err := FindMessage(ctx, messageId)
+	if err != nil || message == nil {
+		return err
+	}
+	threadId := message.MessageId
+	if message.ThreadId != "" {
+		threadId = message.ThreadId
+	}
+	query := "DELETE FROM thread_followers WHERE thread_id=$1 AND user_id=$2"
+	_, err = session.Database(ctx).ExecContext(ctx, query, threadId, user.UserId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func upsertThreadInTx(ctx context.Context, tx *sql.Tx, message *Message) error {
+	t := &Thread{
+		ThreadId:    message.ThreadId,
+		ReplyCount:  1,
+		LastReplyAt: message.CreatedAt,
+		CreatedAt:   time.Now(),
+	}
+	params, positions := compileTableQuery(threadsCols)
+	query := fmt.Sprintf("INSERT INTO threads (%s) VALUES (%s) ON CONFLICT (thread_id) DO UPDATE SET (reply_count,last_reply_at)=(threads.reply_count+1,EXCLUDED.last_reply_at)", params, positions)
+	_, err := tx.ExecContext(ctx, query, t.values()...)
+	if err != nil {
+		return err
+	}
+	query = "INSERT INTO thread_followers (thread_id,user_id,created_at) SELECT message_id,user_id,$2 FROM messages WHERE message_id=$1 ON CONFLICT (thread_id,user_id) DO NOTHING"
+	_, err = tx.ExecContext(ctx, query, t.ThreadId, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	query = "INSERT INTO thread_followers (thread_id,user_id,created_at) VALUES ($1,$2,$3) ON CONFLICT (thread_id,user_id) DO NOTHING"
+	_, err = tx.ExecContext(ctx, query, t.ThreadId, message.UserId, t.CreatedAt)
+	return err
+}
+
+func readThreadFollowers(ctx context.Context, threadId string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	rows, err := session.Database(ctx).QueryContext(ctx, "SELECT user_id FROM thread_followers WHERE thread_id=$1", threadId)
+	if err != nil {
+		return set, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return set, err
+		}
+		set[id] = true
+	}
+	return set, nil
+}
+
+func findMessageWithUser(ctx context.Context, id string) (*Message, error) {
+	query := "SELECT messages.message_id,messages.user_id,messages.category,messages.quote_message_id,messages.data,messages.created_at,users.full_name FROM messages LEFT JOIN users ON messages.user_id=users.user_id WHERE messages.message_id=$1"
+	var m Message
+	err := session.Database(ctx).QueryRowContext(ctx, query, id).Scan(&m.MessageId, &m.UserId, &m.Category, &m.QuoteMessageId, &m.Data, &m.CreatedAt, &m.FullName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	decodeMessagePreview(&m)
+	return &m, nil
+}
+
+func decodeMessagePreview(m *Message) {
+	if m.Category == MessageCategoryPlainText {
+		data, _ := base64.StdEncoding.DecodeString(m.Data)
+		m.Data = string(data)
+	} else {
+		m.Data = ""
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreadCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	user, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "Li", "http://localhost")
+	assert.Nil(err)
+	wang, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1002", "Wang", "http://localhost")
+	assert.Nil(err)
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	root, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(root)
+	assert.Equal("", root.ThreadId)
+	thread, err := ShowThread(ctx, li, root.MessageId, time.Time{})
+	assert.Nil(err)
+	assert.NotNil(thread)
+	assert.Equal(int64(0), thread.ReplyCount)
+	assert.Len(thread.Replies, 0)
+
+	reply, err := CreateMessage(ctx, li, bot.UuidNewV4().String(), MessageCategoryPlainText, root.MessageId, data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(reply)
+	assert.Equal(root.MessageId, reply.ThreadId)
+	nested, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, reply.MessageId, data, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(nested)
+	assert.Equal(root.MessageId, nested.ThreadId)
+	assert.Equal(reply.MessageId, nested.QuoteMessageId)
+
+	thread, err = ShowThread(ctx, li, nested.MessageId, time.Time{})
+	assert.Nil(err)
+	assert.NotNil(thread)
+	assert.Equal(root.MessageId, thread.ThreadId)
+	assert.Equal(int64(2), thread.ReplyCount)
+	assert.Len(thread.Replies, 2)
+	assert.Equal("hello", thread.Root.Data)
+	assert.True(thread.Followed)
+
+	followers, err := readThreadFollowers(ctx, root.MessageId)
+	assert.Nil(err)
+	assert.Len(followers, 2)
+	assert.False(followers[wang.UserId])
+	err = wang.FollowThread(ctx, reply.MessageId)
+	assert.Nil(err)
+	followers, err = readThreadFollowers(ctx, root.MessageId)
+	assert.Nil(err)
+	assert.True(followers[wang.UserId])
+	err = wang.UnfollowThread(ctx, root.MessageId)
+	assert.Nil(err)
+	followers, err = readThreadFollowers(ctx, root.MessageId)
+	assert.Nil(err)
+	assert.False(followers[wang.UserId])
+
+	thread, err = ShowThread(ctx, li, bot.UuidNewV4().String(), time.Time{})
+	assert.Nil(err)
+	assert.Nil(thread)
+}
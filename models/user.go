@@ -26,8 +26,9 @@ const (
 	PaymentStatePending = "pending"
 	PaymentStatePaid    = "paid"
 
-	PayMethodMixin = "mixin"
-	PayMethodOffer = "offer"
+	PayMethodMixin      = "mixin"
+	PayMethodOffer      = "offer"
+	PayMethodInvitation = "invitation"
 
 	UserActivePeriod = 5 * time.Minute
 )
@@ -43,12 +44,18 @@ CREATE TABLE IF NOT EXISTS users (
 	state             VARCHAR(128) NOT NULL,
 	active_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 	subscribed_at     TIMESTAMP WITH TIME ZONE NOT NULL,
-	pay_method        VARCHAR(512) NOT NULL DEFAULT ''
+	pay_method        VARCHAR(512) NOT NULL DEFAULT '',
+	plan              VARCHAR(128) NOT NULL DEFAULT '',
+	expires_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+	invitation_code   VARCHAR(32) NOT NULL DEFAULT '',
+	referrer_id       VARCHAR(36) NOT NULL DEFAULT ''
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS users_identityx ON users(identity_number);
 CREATE INDEX IF NOT EXISTS users_subscribedx ON users(subscribed_at);
 CREATE INDEX IF NOT EXISTS users_activex ON users(active_at);
+CREATE INDEX IF NOT EXISTS users_state_expiresx ON users(state, expires_at);
+CREATE INDEX IF NOT EXISTS users_referrerx ON users(referrer_id);
 `
 
 type User struct {
@@ -62,24 +69,28 @@ type User struct {
 	ActiveAt       time.Time
 	SubscribedAt   time.Time
 	PayMethod      string
+	Plan           string
+	ExpiresAt      time.Time
+	InvitationCode string
+	ReferrerId     string
 
 	isNew               bool
 	AuthenticationToken string
 }
 
-var usersCols = []string{"user_id", "identity_number", "full_name", "access_token", "avatar_url", "trace_id", "state", "active_at", "subscribed_at", "pay_method"}
+var usersCols = []string{"user_id", "identity_number", "full_name", "access_token", "avatar_url", "trace_id", "state", "active_at", "subscribed_at", "pay_method", "plan", "expires_at", "invitation_code", "referrer_id"}
 
 func (u *User) values() []interface{} {
-	return []interface{}{u.UserId, u.IdentityNumber, u.FullName, u.AccessToken, u.AvatarURL, u.TraceId, u.State, u.ActiveAt, u.SubscribedAt, u.PayMethod}
+	return []interface{}{u.UserId, u.IdentityNumber, u.FullName, u.AccessToken, u.AvatarURL, u.TraceId, u.State, u.ActiveAt, u.SubscribedAt, u.PayMethod, u.Plan, u.ExpiresAt, u.InvitationCode, u.ReferrerId}
 }
 
 func userFromRow(row durable.Row) (*User, error) {
 	var u User
-	err := row.Scan(&u.UserId, &u.IdentityNumber, &u.FullName, &u.AccessToken, &u.AvatarURL, &u.TraceId, &u.State, &u.ActiveAt, &u.SubscribedAt, &u.PayMethod)
+	err := row.Scan(&u.UserId, &u.IdentityNumber, &u.FullName, &u.AccessToken, &u.AvatarURL, &u.TraceId, &u.State, &u.ActiveAt, &u.SubscribedAt, &u.PayMethod, &u.Plan, &u.ExpiresAt, &u.InvitationCode, &u.ReferrerId)
 	return &u, err
 }
 
-func AuthenticateUserByOAuth(ctx context.Context, authorizationCode string) (*User, error) {
+func AuthenticateUserByOAuth(ctx context.Context, authorizationCode, referrer string) (*User, error) {
 	accessToken, scope, err := bot.OAuthGetAccessToken(ctx, config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.ClientSecret, authorizationCode, "")
 	if err != nil {
 		return nil, err
@@ -92,7 +103,11 @@ func AuthenticateUserByOAuth(ctx context.Context, authorizationCode string) (*Us
 	if err != nil {
 		return nil, session.ServerError(ctx, err)
 	}
-	return createUser(ctx, accessToken, me.UserId, me.IdentityNumber, me.FullName, me.AvatarURL)
+	user, err := createUser(ctx, accessToken, me.UserId, me.IdentityNumber, me.FullName, me.AvatarURL)
+	if err != nil {
+		return nil, err
+	}
+	return user, user.SetReferrer(ctx, referrer)
 }
 
 func createUser(ctx context.Context, accessToken, userId, identityNumber, fullName, avatarURL string) (*User, error) {
@@ -219,6 +234,9 @@ func AuthenticateUserByToken(ctx context.Context, authenticationToken string) (*
 	if err != nil || !token.Valid {
 		return nil, nil
 	}
+	if err := RefreshRoles(ctx); err != nil {
+		session.Logger(ctx).Error("AuthenticateUserByToken RefreshRoles", err)
+	}
 	if user.ActiveAt.Before(time.Now().Add(-1 * UserActivePeriod)) {
 		err = PingUserActiveAt(ctx, user.UserId)
 		if err != nil {
@@ -268,9 +286,37 @@ func (user *User) Unsubscribe(ctx context.Context) error {
 	return nil
 }
 
-func (user *User) Payment(ctx context.Context) error {
-	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
-		return user.paymentInTx(ctx, tx, PayMethodMixin)
+// Payment records the transfer, then joins or renews the plan priced exactly
+// the transfer, and rotates the trace id so the next renewal could be paid with
+// the same flow. A snapshot is only handled once, and the mismatched ones are
+// refunded as the refund_policy says. A member who never expires has nothing to
+// renew, e.g. lifetime or paid before the plans, the payment is overpaid.
+func (user *User) Payment(ctx context.Context, payment *Payment) error {
+	discount, err := user.invitationDiscount(ctx)
+	if err != nil {
+		return err
+	}
+	payment.UserId = user.UserId
+	payment.classify(discount)
+	if payment.Result == PaymentResultMatched && user.State == PaymentStatePaid && user.ExpiresAt.IsZero() {
+		payment.Result = PaymentResultOverpaid
+	}
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		created, err := createPaymentInTx(ctx, tx, payment)
+		if err != nil || !created {
+			return err
+		}
+		if payment.Result != PaymentResultMatched {
+			return createRefundInTx(ctx, tx, payment.SnapshotId, payment.UserId, payment.AssetId, payment.Amount, payment.Result)
+		}
+		if user.State == PaymentStatePaid {
+			return user.renewInTx(ctx, tx, payment.Plan)
+		}
+		err = user.paymentInTx(ctx, tx, PayMethodMixin, payment.Plan)
+		if err != nil || user.State != PaymentStatePaid {
+			return err
+		}
+		return createReferralRewardInTx(ctx, tx, user, payment)
 	})
 	if err != nil {
 		if sessionErr, ok := err.(session.Error); ok {
@@ -281,7 +327,7 @@ func (user *User) Payment(ctx context.Context) error {
 	return nil
 }
 
-func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) error {
+func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method, plan string) error {
 	if user.State != PaymentStatePending {
 		return nil
 	}
@@ -350,7 +396,10 @@ func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) er
 	user.State = PaymentStatePaid
 	user.SubscribedAt = time.Now()
 	user.PayMethod = method
-	_, err = tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at,pay_method)=($1,$2,$3) WHERE user_id=$4", user.State, user.SubscribedAt, user.PayMethod, user.UserId)
+	user.Plan = plan
+	user.ExpiresAt = subscriptionExpiresAt(plan, user.SubscribedAt)
+	user.TraceId = bot.UuidNewV4().String()
+	_, err = tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at,pay_method,plan,expires_at,trace_id)=($1,$2,$3,$4,$5,$6) WHERE user_id=$7", user.State, user.SubscribedAt, user.PayMethod, user.Plan, user.ExpiresAt, user.TraceId, user.UserId)
 	return err
 }
 
@@ -390,7 +439,7 @@ func PaidMemberCount(ctx context.Context) (int64, error) {
 }
 
 func (user *User) DeleteUser(ctx context.Context, id string) error {
-	if !config.AppConfig.System.Operators[user.UserId] {
+	if !user.Can(PermissionKick) {
 		return nil
 	}
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
@@ -403,6 +452,10 @@ func (user *User) DeleteUser(ctx context.Context, id string) error {
 		if err != nil {
 			return err
 		}
+		err = createAuditLogInTx(ctx, tx, user.UserId, AuditActionKick, u.UserId, fmt.Sprintf("%s, ID: %d", u.FullName, u.IdentityNumber))
+		if err != nil {
+			return err
+		}
 		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE user_id=$1", u.UserId)
 		return err
 	})
@@ -413,24 +466,16 @@ func (user *User) DeleteUser(ctx context.Context, id string) error {
 }
 
 func (user *User) GetRole() string {
-	if config.AppConfig.System.Operators[user.UserId] {
-		return "admin"
-	}
-	return "user"
+	return UserRole(user.UserId)
 }
 
-func (user *User) isAdmin() bool {
-	if config.AppConfig.System.Operators[user.UserId] {
-		return true
-	}
-	return false
+// IsOperator is true for owners, admins and moderators.
+func (user *User) IsOperator() bool {
+	return isOperatorRole(user.GetRole())
 }
 
 func (user *User) isWhiteList() bool {
-	if config.AppConfig.System.WhiteMap[user.UserId] {
-		return true
-	}
-	return false
+	return user.GetRole() == RoleWhitelisted
 }
 
 func subscribedUsers(ctx context.Context, subscribedAt time.Time, limit int) ([]*User, error) {
@@ -65,7 +65,7 @@ func TestUserCRUD(t *testing.T) {
 	err = message.Distribute(ctx)
 	assert.Nil(err)
 
-	err = user.Payment(ctx)
+	err = testPayment(ctx, user, SubscriptionPlanLifetime)
 	assert.Nil(err)
 	user, err = FindUser(ctx, user.UserId)
 	assert.Nil(err)
@@ -77,7 +77,7 @@ func TestUserCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.Len(dms, 0)
 
-	err = user.Payment(ctx)
+	err = testPayment(ctx, user, SubscriptionPlanLifetime)
 	assert.Nil(err)
 	user, err = FindUser(ctx, user.UserId)
 	assert.Nil(err)
@@ -97,7 +97,7 @@ func TestUserCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.NotNil(li)
 	assert.Equal("fullname", li.FullName)
-	err = li.Payment(ctx)
+	err = testPayment(ctx, li, SubscriptionPlanLifetime)
 	assert.Nil(err)
 	users, err = Subscribers(ctx, user.SubscribedAt, 0, "")
 	assert.Nil(err)
@@ -124,24 +124,44 @@ func TestBlacklistCRUD(t *testing.T) {
 
 	admin := &User{UserId: "e9a5b807-fa8b-455a-8dfa-b189d28310ff"}
 	id := bot.UuidNewV4().String()
-	list, err := admin.CreateBlacklist(ctx, id)
+	list, err := admin.CreateBlacklist(ctx, id, "spam")
 	assert.Nil(err)
 	assert.NotNil(list)
-	list, err = readBlacklist(ctx, id)
+	list, err = ReadBlacklist(ctx, id)
 	assert.Nil(err)
 	assert.Nil(list)
 
 	li, err := createUser(ctx, "accessToken", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
 	assert.Nil(err)
 	assert.NotNil(li)
-	list, err = admin.CreateBlacklist(ctx, li.UserId)
+	list, err = admin.CreateBlacklist(ctx, li.UserId, "spam")
 	assert.Nil(err)
 	assert.NotNil(list)
-	list, err = readBlacklist(ctx, li.UserId)
+	list, err = ReadBlacklist(ctx, li.UserId)
 	assert.Nil(err)
 	assert.NotNil(list)
+	assert.Equal(admin.UserId, list.OperatorId)
+	assert.Equal("spam", list.Reason)
+	assert.Equal("name", list.FullName)
+	assert.Equal(int64(1001), list.IdentityNumber)
 
 	user, err := FindUser(ctx, li.UserId)
 	assert.Nil(err)
 	assert.Nil(user)
+
+	blacklists, err := li.ReadBlacklists(ctx, time.Time{}, 100)
+	assert.NotNil(err)
+	blacklists, err = admin.ReadBlacklists(ctx, time.Time{}, 100)
+	assert.Nil(err)
+	assert.Len(blacklists, 1)
+	err = li.DeleteBlacklist(ctx, li.UserId)
+	assert.NotNil(err)
+	err = admin.DeleteBlacklist(ctx, li.UserId)
+	assert.Nil(err)
+	list, err = ReadBlacklist(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Nil(list)
+	blacklists, err = admin.ReadBlacklists(ctx, time.Time{}, 100)
+	assert.Nil(err)
+	assert.Len(blacklists, 0)
 }
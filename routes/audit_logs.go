@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type auditLogsImpl struct{}
+
+func registerAuditLogs(router *httptreemux.TreeMux) {
+	impl := &auditLogsImpl{}
+
+	router.GET("/audit_logs", impl.index)
+}
+
+func (impl *auditLogsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	query := r.URL.Query()
+	offset, _ := time.Parse(time.RFC3339Nano, query.Get("offset"))
+	filter := models.AuditLogFilter{
+		OperatorId: query.Get("operator_id"),
+		Action:     query.Get("action"),
+		TargetId:   query.Get("target_id"),
+		Offset:     offset,
+	}
+	if logs, err := middlewares.CurrentUser(r).ReadAuditLogs(r.Context(), filter); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderAuditLogs(w, r, logs)
+	}
+}
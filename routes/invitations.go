@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type invitationsImpl struct{}
+
+type invitationRequest struct {
+	Plan      string    `json:"plan"`
+	Discount  int64     `json:"discount"`
+	MaxUses   int64     `json:"max_uses"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+func registerInvitations(router *httptreemux.TreeMux) {
+	impl := &invitationsImpl{}
+
+	router.GET("/invitations", impl.index)
+	router.POST("/invitations", impl.create)
+	router.GET("/invitations/:code", impl.show)
+	router.POST("/invitations/:code/revoke", impl.revoke)
+	router.POST("/invitations/:code/redeem", impl.redeem)
+}
+
+func (impl *invitationsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if invitations, err := middlewares.CurrentUser(r).ReadInvitations(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderInvitations(w, r, invitations)
+	}
+}
+
+func (impl *invitationsImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body invitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if invitation, err := middlewares.CurrentUser(r).CreateInvitation(r.Context(), body.Plan, body.Discount, body.MaxUses, body.ExpiredAt); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderInvitation(w, r, invitation)
+	}
+}
+
+func (impl *invitationsImpl) show(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if invitation, err := models.ReadInvitation(r.Context(), params["code"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if invitation == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderInvitation(w, r, invitation)
+	}
+}
+
+func (impl *invitationsImpl) revoke(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).RevokeInvitation(r.Context(), params["code"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
+
+func (impl *invitationsImpl) redeem(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if invitation, err := middlewares.CurrentUser(r).RedeemInvitation(r.Context(), params["code"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderInvitation(w, r, invitation)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
@@ -19,12 +20,18 @@ func registerMesseages(router *httptreemux.TreeMux) {
 	impl := messageImpl{}
 
 	router.GET("/messages", impl.index)
+	router.GET("/messages/search", impl.search)
+	router.GET("/messages/failed", impl.failed)
+	router.POST("/messages/failed/:id/retry", impl.retry)
 	router.POST("/messages/:id/recall", impl.recall)
+	router.GET("/messages/:id/thread", impl.thread)
+	router.POST("/messages/:id/thread/follow", impl.follow)
+	router.POST("/messages/:id/thread/unfollow", impl.unfollow)
 }
 
 func (impl *messageImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
 	user := middlewares.CurrentUser(r)
-	if user.GetRole() != "admin" {
+	if !user.IsOperator() {
 		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
 	} else if messages, err := models.LastestMessageWithUser(r.Context(), 200); err != nil {
 		views.RenderErrorResponse(w, r, err)
@@ -33,6 +40,44 @@ func (impl *messageImpl) index(w http.ResponseWriter, r *http.Request, _ map[str
 	}
 }
 
+func (impl *messageImpl) failed(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	offset, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("offset"))
+	if messages, err := middlewares.CurrentUser(r).FailedDistributedMessages(r.Context(), offset); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderFailedMessages(w, r, messages)
+	}
+}
+
+func (impl *messageImpl) retry(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).RetryDistributedMessage(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
+
+func (impl *messageImpl) search(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	query := r.URL.Query()
+	since, _ := time.Parse(time.RFC3339Nano, query.Get("since"))
+	until, _ := time.Parse(time.RFC3339Nano, query.Get("until"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	search := &models.MessageSearch{
+		Query:    query.Get("q"),
+		UserId:   query.Get("user_id"),
+		Category: query.Get("category"),
+		Since:    since,
+		Until:    until,
+		Cursor:   query.Get("cursor"),
+		Limit:    limit,
+	}
+	if messages, next, err := middlewares.CurrentUser(r).SearchMessages(r.Context(), search); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderMessagesWithCursor(w, r, messages, next)
+	}
+}
+
 func (impl *messageImpl) recall(w http.ResponseWriter, r *http.Request, params map[string]string) {
 	message, err := models.FindMessage(r.Context(), params["id"])
 	if err != nil {
@@ -67,3 +112,30 @@ func (impl *messageImpl) recall(w http.ResponseWriter, r *http.Request, params m
 		views.RenderBlankResponse(w, r)
 	}
 }
+
+func (impl *messageImpl) thread(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	offset, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("offset"))
+	if thread, err := models.ShowThread(r.Context(), middlewares.CurrentUser(r), params["id"], offset); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if thread == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderThread(w, r, thread)
+	}
+}
+
+func (impl *messageImpl) follow(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).FollowThread(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
+
+func (impl *messageImpl) unfollow(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).UnfollowThread(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
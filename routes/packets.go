@@ -3,6 +3,7 @@ package routes
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	number "github.com/MixinNetwork/go-number"
 	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
@@ -15,16 +16,21 @@ import (
 type packetsImpl struct{}
 
 type packetRequest struct {
-	AssetId    string `json:"asset_id"`
-	Amount     string `json:"amount"`
-	TotalCount int64  `json:"total_count"`
-	Greeting   string `json:"greeting"`
+	AssetId    string             `json:"asset_id"`
+	Amount     string             `json:"amount"`
+	TotalCount int64              `json:"total_count"`
+	Greeting   string             `json:"greeting"`
+	Type       string             `json:"type"`
+	Rules      models.PacketRules `json:"rules"`
+	Expiry     int64              `json:"expiry"`
 }
 
 func registerPackets(router *httptreemux.TreeMux) {
 	impl := &packetsImpl{}
 
 	router.GET("/packets/prepare", impl.prepare)
+	router.GET("/packets/leaderboard", impl.leaderboard)
+	router.GET("/me/packets", impl.history)
 	router.POST("/packets", impl.create)
 	router.GET("/packets/:id", impl.show)
 	router.POST("/packets/:id/claim", impl.claim)
@@ -46,7 +52,7 @@ func (impl *packetsImpl) create(w http.ResponseWriter, r *http.Request, params m
 	var body packetRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
-	} else if packet, err := middlewares.CurrentUser(r).CreatePacket(r.Context(), body.AssetId, number.FromString(body.Amount), body.TotalCount, body.Greeting); err != nil {
+	} else if packet, err := middlewares.CurrentUser(r).CreatePacket(r.Context(), body.AssetId, number.FromString(body.Amount), body.TotalCount, body.Greeting, body.Type, body.Rules, body.Expiry); err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
 		views.RenderPacket(w, r, packet)
@@ -80,3 +86,28 @@ func (impl *packetsImpl) assets(w http.ResponseWriter, r *http.Request, _ map[st
 		views.RenderAssets(w, r, assets)
 	}
 }
+
+func (impl *packetsImpl) history(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	sentOffset, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("sent_offset"))
+	receivedOffset, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("received_offset"))
+	if history, err := middlewares.CurrentUser(r).ReadPacketHistory(r.Context(), sentOffset, receivedOffset); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPacketHistory(w, r, history)
+	}
+}
+
+func (impl *packetsImpl) leaderboard(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	category, period := r.URL.Query().Get("category"), r.URL.Query().Get("period")
+	if category == "" {
+		category = models.PacketLeaderboardSenders
+	}
+	if period == "" {
+		period = "week"
+	}
+	if ranks, err := models.PacketLeaderboard(r.Context(), category, period); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPacketLeaderboard(w, r, ranks)
+	}
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type paymentsImpl struct{}
+
+func registerPayments(router *httptreemux.TreeMux) {
+	impl := &paymentsImpl{}
+
+	router.GET("/payments", impl.index)
+	router.GET("/payments/export", impl.export)
+}
+
+func (impl *paymentsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	query := r.URL.Query()
+	offset, _ := time.Parse(time.RFC3339Nano, query.Get("offset"))
+	filter := models.PaymentFilter{
+		UserId: query.Get("user_id"),
+		Result: query.Get("result"),
+		Until:  offset,
+	}
+	if payments, err := middlewares.CurrentUser(r).ReadPayments(r.Context(), filter, models.PaymentsLimit); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPayments(w, r, payments)
+	}
+}
+
+func (impl *paymentsImpl) export(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	query := r.URL.Query()
+	since, _ := time.Parse(time.RFC3339Nano, query.Get("since"))
+	until, _ := time.Parse(time.RFC3339Nano, query.Get("until"))
+	filter := models.PaymentFilter{
+		UserId: query.Get("user_id"),
+		Result: query.Get("result"),
+		Since:  since,
+		Until:  until,
+	}
+	if payments, err := middlewares.CurrentUser(r).ReadPayments(r.Context(), filter, models.PaymentsExportLimit); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPaymentsCSV(w, r, payments)
+	}
+}
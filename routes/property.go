@@ -28,11 +28,11 @@ func (impl *propertyImpl) create(w http.ResponseWriter, r *http.Request, _ map[s
 		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
 		return
 	}
-	if middlewares.CurrentUser(r).GetRole() != "admin" {
+	if !middlewares.CurrentUser(r).Can(models.PermissionProperty) {
 		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
 		return
 	}
-	_, err := models.CreateProperty(r.Context(), models.ProhibitedMessage, body.Value)
+	_, err := middlewares.CurrentUser(r).CreateProperty(r.Context(), models.ProhibitedMessage, body.Value)
 	if err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type refundsImpl struct{}
+
+func registerRefunds(router *httptreemux.TreeMux) {
+	impl := &refundsImpl{}
+
+	router.GET("/refunds", impl.index)
+}
+
+func (impl *refundsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	offset, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("offset"))
+	if refunds, err := middlewares.CurrentUser(r).ReadRefunds(r.Context(), offset); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderRefunds(w, r, refunds)
+	}
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type reviewsImpl struct{}
+
+func registerReviews(router *httptreemux.TreeMux) {
+	impl := &reviewsImpl{}
+
+	router.GET("/reviews", impl.index)
+	router.POST("/reviews/:id/:decision", impl.review)
+}
+
+func (impl *reviewsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	decision := r.URL.Query().Get("decision")
+	if decision == "" {
+		decision = models.ReviewDecisionPending
+	}
+	offset, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("offset"))
+	if !middlewares.CurrentUser(r).Can(models.PermissionReview) {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else if reviews, err := models.ReadMessageReviews(r.Context(), decision, offset, 100); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderMessageReviews(w, r, reviews)
+	}
+}
+
+func (impl *reviewsImpl) review(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if review, err := middlewares.CurrentUser(r).ReviewMessage(r.Context(), params["id"], params["decision"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if review == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderMessageReview(w, r, review)
+	}
+}
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type rolesImpl struct{}
+
+func registerRoles(router *httptreemux.TreeMux) {
+	impl := &rolesImpl{}
+
+	router.GET("/roles", impl.index)
+	router.POST("/roles/:id", impl.grant)
+	router.POST("/roles/:id/revoke", impl.revoke)
+}
+
+func (impl *rolesImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if roles, err := middlewares.CurrentUser(r).ReadRoles(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderRoles(w, r, roles)
+	}
+}
+
+func (impl *rolesImpl) grant(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body struct {
+		Role        string   `json:"role"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if role, err := middlewares.CurrentUser(r).GrantRole(r.Context(), params["id"], body.Role, body.Permissions); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderRole(w, r, role)
+	}
+}
+
+func (impl *rolesImpl) revoke(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).RevokeRole(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
@@ -17,6 +17,15 @@ func RegisterRoutes(router *httptreemux.TreeMux) {
 	registerMesseages(router)
 	registerProperties(router)
 	registerBroadcasters(router)
+	registerSchedules(router)
+	registerReviews(router)
+	registerBlacklists(router)
+	registerAuditLogs(router)
+	registerRoles(router)
+	registerPayments(router)
+	registerRefunds(router)
+	registerInvitations(router)
+	registerShards(router)
 }
 
 func root(w http.ResponseWriter, r *http.Request, params map[string]string) {
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type schedulesImpl struct{}
+
+type scheduleRequest struct {
+	Category    string    `json:"category"`
+	Data        string    `json:"data"`
+	Recurrence  string    `json:"recurrence"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+func registerSchedules(router *httptreemux.TreeMux) {
+	impl := &schedulesImpl{}
+
+	router.POST("/schedules", impl.create)
+	router.GET("/schedules", impl.index)
+	router.POST("/schedules/:id", impl.update)
+	router.POST("/schedules/:id/cancel", impl.cancel)
+}
+
+func (impl *schedulesImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if s, err := middlewares.CurrentUser(r).CreateScheduledMessage(r.Context(), body.Category, body.Data, body.Recurrence, body.ScheduledAt); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderScheduledMessage(w, r, s)
+	}
+}
+
+func (impl *schedulesImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if schedules, err := middlewares.CurrentUser(r).ListScheduledMessages(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderScheduledMessages(w, r, schedules)
+	}
+}
+
+func (impl *schedulesImpl) update(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if s, err := middlewares.CurrentUser(r).UpdateScheduledMessage(r.Context(), params["id"], body.Category, body.Data, body.Recurrence, body.ScheduledAt); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if s == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderScheduledMessage(w, r, s)
+	}
+}
+
+func (impl *schedulesImpl) cancel(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if s, err := middlewares.CurrentUser(r).CancelScheduledMessage(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if s == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderScheduledMessage(w, r, s)
+	}
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type shardsImpl struct{}
+
+func registerShards(router *httptreemux.TreeMux) {
+	impl := &shardsImpl{}
+
+	router.GET("/shards", impl.index)
+	router.POST("/shards", impl.resize)
+}
+
+func (impl *shardsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if shards, err := middlewares.CurrentUser(r).ReadMessageShards(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderMessageShards(w, r, shards)
+	}
+}
+
+func (impl *shardsImpl) resize(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body struct {
+		Size int64 `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	current := middlewares.CurrentUser(r)
+	if err := current.ResizeMessageShards(r.Context(), body.Size); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if shards, err := current.ReadMessageShards(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderMessageShards(w, r, shards)
+	}
+}
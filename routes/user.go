@@ -24,10 +24,13 @@ func registerUsers(router *httptreemux.TreeMux) {
 	impl := &usersImpl{}
 	router.POST("/auth", impl.authenticate)
 	router.POST("/account", impl.update)
+	router.POST("/account/referrer", impl.referrer)
 	router.POST("/subscribe", impl.subscribe)
 	router.POST("/unsubscribe", impl.unsubscribe)
 	router.POST("/users/:id/remove", impl.remove)
 	router.POST("/users/:id/block", impl.block)
+	router.POST("/users/:id/mute", impl.mute)
+	router.POST("/users/:id/unmute", impl.unmute)
 	router.GET("/me", impl.me)
 	router.GET("/subscribers", impl.subscribers)
 	router.GET("/users/:id", impl.show)
@@ -37,11 +40,12 @@ func registerUsers(router *httptreemux.TreeMux) {
 
 func (impl *usersImpl) authenticate(w http.ResponseWriter, r *http.Request, params map[string]string) {
 	var body struct {
-		Code string `json:"code"`
+		Code     string `json:"code"`
+		Referrer string `json:"referrer"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
-	} else if user, err := models.AuthenticateUserByOAuth(r.Context(), body.Code); err != nil {
+	} else if user, err := models.AuthenticateUserByOAuth(r.Context(), body.Code, body.Referrer); err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
 		views.RenderAccount(w, r, user)
@@ -62,6 +66,22 @@ func (impl *usersImpl) update(w http.ResponseWriter, r *http.Request, params map
 	}
 }
 
+func (impl *usersImpl) referrer(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body struct {
+		Referrer string `json:"referrer"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	current := middlewares.CurrentUser(r)
+	if err := current.SetReferrer(r.Context(), body.Referrer); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderAccount(w, r, current)
+	}
+}
+
 func (impl *usersImpl) me(w http.ResponseWriter, r *http.Request, _ map[string]string) {
 	user := middlewares.CurrentUser(r)
 	b, _ := models.ReadBlacklist(r.Context(), user.UserId)
@@ -106,7 +126,9 @@ func (impl *usersImpl) unsubscribe(w http.ResponseWriter, r *http.Request, _ map
 }
 
 func (impl *usersImpl) remove(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if err := middlewares.CurrentUser(r).DeleteUser(r.Context(), params["id"]); err != nil {
+	if !middlewares.CurrentUser(r).Can(models.PermissionKick) {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else if err := middlewares.CurrentUser(r).DeleteUser(r.Context(), params["id"]); err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
 		views.RenderBlankResponse(w, r)
@@ -114,7 +136,38 @@ func (impl *usersImpl) remove(w http.ResponseWriter, r *http.Request, params map
 }
 
 func (impl *usersImpl) block(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if _, err := middlewares.CurrentUser(r).CreateBlacklist(r.Context(), params["id"]); err != nil {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	if !middlewares.CurrentUser(r).Can(models.PermissionBan) {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else if _, err := middlewares.CurrentUser(r).CreateBlacklist(r.Context(), params["id"], body.Reason); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
+
+func (impl *usersImpl) mute(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if duration, err := models.ParseMuteDuration(body.Duration); err != nil {
+		views.RenderErrorResponse(w, r, session.BadDataError(r.Context()))
+	} else if mute, err := middlewares.CurrentUser(r).CreateMute(r.Context(), params["id"], duration); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if mute == nil {
+		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	} else {
+		views.RenderMute(w, r, mute)
+	}
+}
+
+func (impl *usersImpl) unmute(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := middlewares.CurrentUser(r).DeleteMute(r.Context(), params["id"]); err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
 		views.RenderBlankResponse(w, r)
@@ -8,12 +8,18 @@ CREATE TABLE IF NOT EXISTS users (
   state             VARCHAR(128) NOT NULL,
   active_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   subscribed_at     TIMESTAMP WITH TIME ZONE NOT NULL,
-  pay_method        VARCHAR(512) NOT NULL DEFAULT ''
+  pay_method        VARCHAR(512) NOT NULL DEFAULT '',
+  plan              VARCHAR(128) NOT NULL DEFAULT '',
+  expires_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+  invitation_code   VARCHAR(32) NOT NULL DEFAULT '',
+  referrer_id       VARCHAR(36) NOT NULL DEFAULT ''
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS users_identityx ON users(identity_number);
 CREATE INDEX IF NOT EXISTS users_subscribedx ON users(subscribed_at);
 CREATE INDEX IF NOT EXISTS users_activex ON users(active_at);
+CREATE INDEX IF NOT EXISTS users_state_expiresx ON users(state, expires_at);
+CREATE INDEX IF NOT EXISTS users_referrerx ON users(referrer_id);
 
 
 CREATE TABLE IF NOT EXISTS messages (
@@ -21,7 +27,9 @@ CREATE TABLE IF NOT EXISTS messages (
   user_id               VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
   category              VARCHAR(512) NOT NULL,
   quote_message_id      VARCHAR(36) NOT NULL DEFAULT '',
+  thread_id             VARCHAR(36) NOT NULL DEFAULT '',
   data                  TEXT NOT NULL,
+  search_text           TEXT NOT NULL DEFAULT '',
   created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   updated_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   state                 VARCHAR(128) NOT NULL,
@@ -29,6 +37,8 @@ CREATE TABLE IF NOT EXISTS messages (
 );
 
 CREATE INDEX IF NOT EXISTS messages_state_updatedx ON messages(state, updated_at);
+CREATE INDEX IF NOT EXISTS messages_thread_createdx ON messages(thread_id, created_at);
+CREATE INDEX IF NOT EXISTS messages_searchx ON messages USING GIN (to_tsvector('simple', search_text));
 
 
 CREATE TABLE IF NOT EXISTS distributed_messages (
@@ -42,10 +52,15 @@ CREATE TABLE IF NOT EXISTS distributed_messages (
   category              VARCHAR(512) NOT NULL,
   data                  TEXT NOT NULL,
   status                VARCHAR(512) NOT NULL,
-  created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+  created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  attempts              INTEGER NOT NULL DEFAULT 0,
+  next_at               TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+  last_error            VARCHAR(1024) NOT NULL DEFAULT ''
 );
 
 CREATE INDEX IF NOT EXISTS message_shard_statusx ON distributed_messages(shard, status, created_at);
+CREATE INDEX IF NOT EXISTS message_parent_statusx ON distributed_messages(parent_id, status);
+CREATE INDEX IF NOT EXISTS message_status_createdx ON distributed_messages(status, created_at);
 
 
 CREATE TABLE IF NOT EXISTS packets (
@@ -58,10 +73,15 @@ CREATE TABLE IF NOT EXISTS packets (
   remaining_count   BIGINT NOT NULL,
   remaining_amount  VARCHAR(128) NOT NULL,
   state             VARCHAR(36) NOT NULL,
-  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  type              VARCHAR(36) NOT NULL DEFAULT 'lucky',
+  rules             TEXT NOT NULL DEFAULT '{}',
+  expired_at        TIMESTAMP WITH TIME ZONE NOT NULL
 );
 
 CREATE INDEX IF NOT EXISTS packets_state_createdx ON packets(state, created_at);
+CREATE INDEX IF NOT EXISTS packets_state_expiredx ON packets(state, expired_at);
+CREATE INDEX IF NOT EXISTS packets_user_createdx ON packets(user_id, created_at);
 
 
 CREATE TABLE IF NOT EXISTS participants (
@@ -74,6 +94,7 @@ CREATE TABLE IF NOT EXISTS participants (
 );
 
 CREATE INDEX IF NOT EXISTS participants_created_paidx ON participants(created_at, paid_at);
+CREATE INDEX IF NOT EXISTS participants_user_createdx ON participants(user_id, created_at);
 
 
 CREATE TABLE IF NOT EXISTS assets (
@@ -87,9 +108,16 @@ CREATE TABLE IF NOT EXISTS assets (
 
 
 CREATE TABLE IF NOT EXISTS blacklists (
-  user_id	          VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$')
+  user_id	          VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  operator_id       VARCHAR(36) NOT NULL DEFAULT '',
+  reason            VARCHAR(1024) NOT NULL DEFAULT '',
+  full_name         VARCHAR(512) NOT NULL DEFAULT '',
+  identity_number   BIGINT NOT NULL DEFAULT 0,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
+CREATE INDEX IF NOT EXISTS blacklists_createdx ON blacklists(created_at);
+
 CREATE TABLE IF NOT EXISTS properties (
   name               VARCHAR(512) PRIMARY KEY,
   value              VARCHAR(1024) NOT NULL,
@@ -117,3 +145,151 @@ CREATE TABLE IF NOT EXISTS rewards (
 );
 
 CREATE INDEX IF NOT EXISTS rewards_paidx ON rewards(paid_at);
+
+
+CREATE TABLE IF NOT EXISTS threads (
+  thread_id          VARCHAR(36) PRIMARY KEY CHECK (thread_id ~* '^[0-9a-f-]{36,36}$'),
+  reply_count        BIGINT NOT NULL,
+  last_reply_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS threads_last_replyx ON threads(last_reply_at);
+
+
+CREATE TABLE IF NOT EXISTS thread_followers (
+  thread_id          VARCHAR(36) NOT NULL CHECK (thread_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(thread_id, user_id)
+);
+
+
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+  schedule_id        VARCHAR(36) PRIMARY KEY CHECK (schedule_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  category           VARCHAR(512) NOT NULL,
+  data               TEXT NOT NULL,
+  recurrence         VARCHAR(128) NOT NULL DEFAULT '',
+  next_at            TIMESTAMP WITH TIME ZONE NOT NULL,
+  state              VARCHAR(128) NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_messages_state_nextx ON scheduled_messages(state, next_at);
+
+
+CREATE TABLE IF NOT EXISTS message_reviews (
+  message_id         VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  reason             VARCHAR(1024) NOT NULL,
+  decision           VARCHAR(128) NOT NULL,
+  reviewer_id        VARCHAR(36) NOT NULL DEFAULT '',
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS message_reviews_decision_createdx ON message_reviews(decision, created_at);
+
+
+CREATE TABLE IF NOT EXISTS mutes (
+  user_id            VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  operator_id        VARCHAR(36) NOT NULL CHECK (operator_id ~* '^[0-9a-f-]{36,36}$'),
+  expired_at         TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mutes_expiredx ON mutes(expired_at);
+
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+  log_id             VARCHAR(36) PRIMARY KEY CHECK (log_id ~* '^[0-9a-f-]{36,36}$'),
+  operator_id        VARCHAR(36) NOT NULL CHECK (operator_id ~* '^[0-9a-f-]{36,36}$'),
+  action             VARCHAR(128) NOT NULL,
+  target_id          VARCHAR(512) NOT NULL DEFAULT '',
+  detail             VARCHAR(1024) NOT NULL DEFAULT '',
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_createdx ON audit_logs(created_at);
+CREATE INDEX IF NOT EXISTS audit_logs_operator_createdx ON audit_logs(operator_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_logs_target_createdx ON audit_logs(target_id, created_at);
+
+
+CREATE TABLE IF NOT EXISTS roles (
+  user_id            VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  role               VARCHAR(128) NOT NULL,
+  granted_by         VARCHAR(36) NOT NULL CHECK (granted_by ~* '^[0-9a-f-]{36,36}$'),
+  permissions        VARCHAR(1024) NOT NULL DEFAULT '',
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS roles_role_updatedx ON roles(role, updated_at);
+
+
+CREATE TABLE IF NOT EXISTS payments (
+  snapshot_id        VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  trace_id           VARCHAR(36) NOT NULL CHECK (trace_id ~* '^[0-9a-f-]{36,36}$'),
+  asset_id           VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount             VARCHAR(128) NOT NULL,
+  expected_amount    VARCHAR(128) NOT NULL DEFAULT '',
+  plan               VARCHAR(128) NOT NULL DEFAULT '',
+  result             VARCHAR(128) NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS payments_createdx ON payments(created_at);
+CREATE INDEX IF NOT EXISTS payments_user_createdx ON payments(user_id, created_at);
+
+
+CREATE TABLE IF NOT EXISTS refunds (
+  snapshot_id        VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  asset_id           VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount             VARCHAR(128) NOT NULL,
+  reason             VARCHAR(128) NOT NULL,
+  paid_at            TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_paidx ON refunds(paid_at);
+CREATE INDEX IF NOT EXISTS refunds_createdx ON refunds(created_at);
+
+
+CREATE TABLE IF NOT EXISTS invitations (
+  code               VARCHAR(32) PRIMARY KEY,
+  creator_id         VARCHAR(36) NOT NULL CHECK (creator_id ~* '^[0-9a-f-]{36,36}$'),
+  plan               VARCHAR(128) NOT NULL DEFAULT '',
+  discount           BIGINT NOT NULL DEFAULT 0,
+  max_uses           BIGINT NOT NULL DEFAULT 1,
+  used_count         BIGINT NOT NULL DEFAULT 0,
+  expired_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitations_creator_createdx ON invitations(creator_id, created_at);
+
+
+CREATE TABLE IF NOT EXISTS referral_rewards (
+  snapshot_id        VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+  referrer_id        VARCHAR(36) NOT NULL CHECK (referrer_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  asset_id           VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount             VARCHAR(128) NOT NULL,
+  paid_at            TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS referral_rewards_paidx ON referral_rewards(paid_at);
+CREATE INDEX IF NOT EXISTS referral_rewards_referrer_createdx ON referral_rewards(referrer_id, created_at);
+
+
+CREATE TABLE IF NOT EXISTS leases (
+  name               VARCHAR(256) PRIMARY KEY,
+  owner_id           VARCHAR(36) NOT NULL,
+  expired_at         TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
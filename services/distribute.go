@@ -1,47 +1,62 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"io/ioutil"
-	"net/http"
 	"time"
 
-	"github.com/MixinNetwork/bot-api-go-client"
-
+	bot "github.com/MixinNetwork/bot-api-go-client"
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 )
 
+const (
+	distributeLimit = 80
+)
+
 func distribute(ctx context.Context) {
-	limit := int64(80)
-	system := config.AppConfig.System
-	shards := make([]string, system.MessageShardSize)
-	for i := int64(0); i < system.MessageShardSize; i++ {
-		shard := shardId(system.MessageShardModifier, i)
-		shards[i] = shard
-		go pendingActiveDistributedMessages(ctx, shard, limit)
+	outboundThrottle.configure(config.AppConfig.System.MessageRateLimit)
+	go loopMessageThrottle(ctx)
+
+	workers := make(map[string]context.CancelFunc)
+	for {
+		err := rebalanceShards(ctx, serviceInstanceId, workers)
+		if err != nil {
+			session.Logger(ctx).Errorf("rebalanceShards ERROR: %+v", err)
+		}
+		time.Sleep(leaseRenewal)
 	}
+}
 
-	if config.AppConfig.System.ImmediateDeleteExpiredDistributedMsgEnable {
-		for {
-			count, err := models.ClearUpExpiredDistributedMessages(ctx, shards)
-			if err != nil {
-				session.Logger(ctx).Errorf("ClearUpExpiredDistributedMessages ERROR: %+v", err)
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
-			if count < 100 {
-				time.Sleep(time.Minute)
-			}
+// clearUpExpiredDistributedMessages covers the shards of any size, so that the
+// shards removed by resizing are cleaned up too.
+func clearUpExpiredDistributedMessages(ctx context.Context) {
+	shards := models.AllMessageShards()
+	for ctx.Err() == nil {
+		count, err := models.ClearUpExpiredDistributedMessages(ctx, shards)
+		if err != nil {
+			session.Logger(ctx).Errorf("ClearUpExpiredDistributedMessages ERROR: %+v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(time.Minute)
 		}
 	}
 }
 
+const (
+	distributeRetryInterval    = 100 * time.Millisecond
+	distributeMaxRetryInterval = 10 * time.Second
+)
+
+// pendingActiveDistributedMessages backs off the shard when the network or the
+// API fails, the messages rejected are retried later one by one, so that they
+// don't stall the shard.
 func pendingActiveDistributedMessages(ctx context.Context, shard string, limit int64) {
-	for {
+	interval := distributeRetryInterval
+	for ctx.Err() == nil {
 		messages, err := models.PendingActiveDistributedMessages(ctx, shard, limit)
 		if err != nil {
 			session.Logger(ctx).Errorf("PendingActiveDistributedMessages ERROR: %+v", err)
@@ -52,19 +67,75 @@ func pendingActiveDistributedMessages(ctx context.Context, shard string, limit i
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
-		err = sendDistributedMessges(ctx, shard, messages)
-		if err != nil {
-			session.Logger(ctx).Errorf("PendingActiveDistributedMessages sendDistributedMessges ERROR: %+v", err)
-			time.Sleep(100 * time.Millisecond)
+		delivered, rejected, sendErr := bisectDistributedMessages(ctx, shard, messages)
+		if len(delivered) > 0 {
+			err = models.UpdateMessagesStatus(ctx, delivered)
+			if err != nil {
+				session.Logger(ctx).Errorf("PendingActiveDistributedMessages UpdateMessagesStatus ERROR: %+v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+		}
+		if len(rejected) > 0 {
+			err = models.UpdateMessagesFailure(ctx, rejected)
+			if err != nil {
+				session.Logger(ctx).Errorf("PendingActiveDistributedMessages UpdateMessagesFailure ERROR: %+v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+		}
+		if sendErr != nil {
+			session.Logger(ctx).Errorf("PendingActiveDistributedMessages sendDistributedMessges ERROR: %+v", sendErr)
+			time.Sleep(interval)
+			if interval *= 2; interval > distributeMaxRetryInterval {
+				interval = distributeMaxRetryInterval
+			}
 			continue
 		}
-		err = models.UpdateMessagesStatus(ctx, messages)
+		interval = distributeRetryInterval
+	}
+}
+
+// bisectDistributedMessages splits the batch rejected by the API in halves,
+// until the messages rejected alone are found. It stops at the errors of the
+// network or the API, which are not caused by the messages.
+func bisectDistributedMessages(ctx context.Context, shard string, messages []*models.DistributedMessage) ([]*models.DistributedMessage, []*models.DistributedMessage, error) {
+	err := sendDistributedMessges(ctx, shard, messages)
+	if err == nil {
+		return messages, nil, nil
+	}
+	if !distributedMessagesRejected(err) {
+		return nil, nil, err
+	}
+	if len(messages) == 1 {
+		messages[0].LastError = err.Error()
+		return nil, messages, nil
+	}
+	var delivered, rejected []*models.DistributedMessage
+	half := len(messages) / 2
+	for _, batch := range [][]*models.DistributedMessage{messages[:half], messages[half:]} {
+		d, r, err := bisectDistributedMessages(ctx, shard, batch)
+		delivered = append(delivered, d...)
+		rejected = append(rejected, r...)
 		if err != nil {
-			session.Logger(ctx).Errorf("PendingActiveDistributedMessages UpdateMessagesStatus ERROR: %+v", err)
-			time.Sleep(100 * time.Millisecond)
-			continue
+			return delivered, rejected, err
 		}
 	}
+	return delivered, rejected, nil
+}
+
+func distributedMessagesRejected(err error) bool {
+	e, ok := err.(bot.Error)
+	if !ok || e.Code <= 0 {
+		return false
+	}
+	switch {
+	case e.Code == 401, e.Code == 429, e.Code == 7000:
+		return false
+	case e.Code >= 500 && e.Code < 600:
+		return false
+	}
+	return true
 }
 
 func sendDistributedMessges(ctx context.Context, key string, messages []*models.DistributedMessage) error {
@@ -93,49 +164,10 @@ func sendDistributedMessges(ctx context.Context, key string, messages []*models.
 	if err != nil {
 		return err
 	}
-	mixin := config.AppConfig.Mixin
-	accessToken, err := bot.SignAuthenticationToken(mixin.ClientId, mixin.SessionId, mixin.SessionKey, "POST", "/messages", string(msgs))
-	if err != nil {
-		return err
-	}
-	data, err := request(ctx, key, "POST", "/messages", msgs, accessToken)
-	if err != nil {
-		return err
-	}
-	var resp struct {
-		Error bot.Error `json:"error"`
-	}
-	err = json.Unmarshal(data, &resp)
-	if err != nil {
+	if err := outboundThrottle.wait(ctx, len(messages)); err != nil {
 		return err
 	}
-	if resp.Error.Code > 0 {
-		return resp.Error
-	}
-	return nil
-}
-
-var httpPool map[string]*http.Client = make(map[string]*http.Client, 0)
-
-func request(ctx context.Context, key, method, path string, body []byte, accessToken string) ([]byte, error) {
-	if httpPool[key] == nil {
-		httpPool[key] = &http.Client{Timeout: 3 * time.Second}
-	}
-	req, err := http.NewRequest(method, "https://mixin-api.zeromesh.net"+path, bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	//req.Close = true
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	resp, err := httpPool[key].Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 500 {
-		return nil, bot.ServerError(ctx, nil)
-	}
-	return ioutil.ReadAll(resp.Body)
+	err = session.Transport(ctx).PostMessages(ctx, key, msgs)
+	outboundThrottle.done(ctx, len(messages), err)
+	return err
 }
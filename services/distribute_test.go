@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBisectDistributedMessages(t *testing.T) {
+	assert := assert.New(t)
+	config.AppConfig = &config.Config{}
+	fake := NewFakeTransport()
+	defer fake.Close()
+	ctx := session.WithLogger(context.Background(), durable.BuildLogger())
+	ctx = session.WithTransport(ctx, fake)
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	messages := make([]*models.DistributedMessage, 5)
+	for i := range messages {
+		messages[i] = &models.DistributedMessage{
+			MessageId:      bot.UuidNewV4().String(),
+			ConversationId: bot.UuidNewV4().String(),
+			RecipientId:    bot.UuidNewV4().String(),
+			Category:       models.MessageCategoryPlainText,
+			Data:           data,
+		}
+	}
+	delivered, rejected, err := bisectDistributedMessages(ctx, "shard", messages)
+	assert.Nil(err)
+	assert.Len(delivered, 5)
+	assert.Len(rejected, 0)
+
+	fake.Reject(messages[3].RecipientId)
+	delivered, rejected, err = bisectDistributedMessages(ctx, "shard", messages)
+	assert.Nil(err)
+	assert.Len(delivered, 4)
+	assert.Len(rejected, 1)
+	assert.Equal(messages[3].MessageId, rejected[0].MessageId)
+	assert.NotEqual("", rejected[0].LastError)
+	assert.Len(fake.Messages(), 9)
+
+	assert.True(distributedMessagesRejected(bot.ForbiddenError(ctx)))
+	assert.True(distributedMessagesRejected(bot.BadDataError(ctx)))
+	assert.False(distributedMessagesRejected(bot.ServerError(ctx, nil)))
+	assert.False(distributedMessagesRejected(bot.AuthorizationError(ctx)))
+	assert.False(distributedMessagesRejected(context.DeadlineExceeded))
+}
+
+func TestFairShardShare(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(6, fairShardShare(6, 0))
+	assert.Equal(6, fairShardShare(6, 1))
+	assert.Equal(3, fairShardShare(6, 2))
+	assert.Equal(2, fairShardShare(6, 4))
+	assert.Equal(1, fairShardShare(6, 8))
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// FakeTransport is an in-process Mixin server, it speaks the gzip Blaze
+// framing over a local websocket and records every REST call, so the
+// message service can run end to end without the network.
+type FakeTransport struct {
+	server *httptest.Server
+	mutex  sync.Mutex
+
+	conns       []*fakeConn
+	blaze       []BlazeMessage
+	messages    []map[string]interface{}
+	transfers   []*bot.TransferInput
+	attachments map[string][]byte
+	rejected    map[string]bool
+	throttled   int
+}
+
+type fakeConn struct {
+	mutex sync.Mutex
+	conn  *websocket.Conn
+}
+
+func NewFakeTransport() *FakeTransport {
+	fake := &FakeTransport{attachments: make(map[string][]byte), rejected: make(map[string]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", fake.serveBlaze)
+	mux.HandleFunc("/attachments/", fake.serveAttachment)
+	fake.server = httptest.NewServer(mux)
+	return fake
+}
+
+func (fake *FakeTransport) Close() {
+	fake.mutex.Lock()
+	for _, fc := range fake.conns {
+		fc.conn.Close()
+	}
+	fake.conns = nil
+	fake.mutex.Unlock()
+	fake.server.Close()
+}
+
+func (fake *FakeTransport) ConnectBlaze(ctx context.Context) (*websocket.Conn, error) {
+	dialer := &websocket.Dialer{
+		Subprotocols: []string{"Mixin-Blaze-1"},
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(fake.server.URL, "http")+"/", nil)
+	return conn, err
+}
+
+func (fake *FakeTransport) PostMessages(ctx context.Context, key string, messages []byte) error {
+	var body []map[string]interface{}
+	err := json.Unmarshal(messages, &body)
+	if err != nil {
+		return err
+	}
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if fake.throttled > 0 {
+		fake.throttled--
+		return bot.Error{Status: 429, Code: 429, Description: "Too Many Requests"}
+	}
+	for _, m := range body {
+		if id, _ := m["recipient_id"].(string); fake.rejected[id] {
+			return bot.ForbiddenError(ctx)
+		}
+	}
+	fake.messages = append(fake.messages, body...)
+	return nil
+}
+
+// Reject fails every batch of messages to the recipient, like a user who
+// blocked the bot.
+func (fake *FakeTransport) Reject(recipientId string) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.rejected[recipientId] = true
+}
+
+// Throttle fails the next n batches of messages with 429, like the API does
+// when the bot posts too fast.
+func (fake *FakeTransport) Throttle(n int) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.throttled = n
+}
+
+func (fake *FakeTransport) CreateTransfer(ctx context.Context, in *bot.TransferInput) error {
+	transfer := *in
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	for _, t := range fake.transfers {
+		if t.TraceId == transfer.TraceId {
+			return nil
+		}
+	}
+	fake.transfers = append(fake.transfers, &transfer)
+	return nil
+}
+
+func (fake *FakeTransport) ShowAttachment(ctx context.Context, id string) (*bot.Attachment, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if fake.attachments[id] == nil {
+		return nil, bot.BadDataError(ctx)
+	}
+	return &bot.Attachment{
+		Type:         "attachment",
+		AttachmentId: id,
+		ViewURL:      fake.server.URL + "/attachments/" + id,
+	}, nil
+}
+
+func (fake *FakeTransport) AddAttachment(id string, data []byte) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.attachments[id] = data
+}
+
+// Push writes a server initiated Blaze message to every connected client.
+func (fake *FakeTransport) Push(action string, data interface{}) error {
+	msg, err := json.Marshal(BlazeMessage{Id: bot.UuidNewV4().String(), Action: action, Data: data})
+	if err != nil {
+		return err
+	}
+	fake.mutex.Lock()
+	conns := make([]*fakeConn, len(fake.conns))
+	copy(conns, fake.conns)
+	fake.mutex.Unlock()
+	for _, fc := range conns {
+		if err := fc.write(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fake *FakeTransport) PushMessage(msg MessageView) error {
+	return fake.Push("CREATE_MESSAGE", msg)
+}
+
+func (fake *FakeTransport) PushTransfer(userId string, transfer TransferView) error {
+	data, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+	return fake.PushMessage(MessageView{
+		UserId:    userId,
+		MessageId: bot.UuidNewV4().String(),
+		Category:  "SYSTEM_ACCOUNT_SNAPSHOT",
+		Data:      base64.StdEncoding.EncodeToString(data),
+		CreatedAt: transfer.CreatedAt,
+		UpdatedAt: transfer.CreatedAt,
+	})
+}
+
+func (fake *FakeTransport) BlazeMessages() []BlazeMessage {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return append([]BlazeMessage{}, fake.blaze...)
+}
+
+func (fake *FakeTransport) Messages() []map[string]interface{} {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return append([]map[string]interface{}{}, fake.messages...)
+}
+
+func (fake *FakeTransport) Transfers() []*bot.TransferInput {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return append([]*bot.TransferInput{}, fake.transfers...)
+}
+
+func (fake *FakeTransport) serveBlaze(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"Mixin-Blaze-1"}}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	fc := &fakeConn{conn: conn}
+	fake.mutex.Lock()
+	fake.conns = append(fake.conns, fc)
+	fake.mutex.Unlock()
+	defer conn.Close()
+
+	for {
+		messageType, wsReader, err := conn.NextReader()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.BinaryMessage {
+			return
+		}
+		gzReader, err := gzip.NewReader(wsReader)
+		if err != nil {
+			return
+		}
+		var message BlazeMessage
+		err = json.NewDecoder(gzReader).Decode(&message)
+		gzReader.Close()
+		if err != nil {
+			return
+		}
+		fake.mutex.Lock()
+		fake.blaze = append(fake.blaze, message)
+		fake.mutex.Unlock()
+
+		resp, err := json.Marshal(BlazeMessage{Id: message.Id, Action: message.Action})
+		if err != nil {
+			return
+		}
+		if err := fc.write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (fake *FakeTransport) serveAttachment(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/attachments/")
+	fake.mutex.Lock()
+	data := fake.attachments[id]
+	fake.mutex.Unlock()
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func (fc *fakeConn) write(msg []byte) error {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return writeGzipToConn(context.Background(), fc.conn, msg)
+}
+
+func TestFakeTransport(t *testing.T) {
+	assert := assert.New(t)
+	config.AppConfig = &config.Config{}
+	fake := NewFakeTransport()
+	defer fake.Close()
+	ctx := session.WithLogger(context.Background(), durable.BuildLogger())
+	ctx = session.WithTransport(ctx, fake)
+
+	conn, err := session.Transport(ctx).ConnectBlaze(ctx)
+	assert.Nil(err)
+	defer conn.Close()
+	mc := newMessageContext()
+	go writePump(ctx, conn, mc)
+	go readPump(ctx, conn, mc)
+
+	err = writeMessageAndWait(ctx, mc, "LIST_PENDING_MESSAGES", nil)
+	assert.Nil(err)
+	blaze := fake.BlazeMessages()
+	assert.Len(blaze, 1)
+	assert.Equal("LIST_PENDING_MESSAGES", blaze[0].Action)
+
+	userId := bot.UuidNewV4().String()
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	err = fake.PushMessage(MessageView{UserId: userId, MessageId: bot.UuidNewV4().String(), Category: models.MessageCategoryPlainText, Data: data})
+	assert.Nil(err)
+	select {
+	case msg := <-mc.ReadBuffer:
+		assert.Equal(userId, msg.UserId)
+		assert.Equal(data, msg.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout to read pushed message")
+	}
+
+	err = fake.PushTransfer(userId, TransferView{TraceId: bot.UuidNewV4().String(), Amount: "1"})
+	assert.Nil(err)
+	select {
+	case msg := <-mc.ReadBuffer:
+		assert.Equal("SYSTEM_ACCOUNT_SNAPSHOT", msg.Category)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout to read pushed transfer")
+	}
+
+	dm := &models.DistributedMessage{
+		MessageId:      bot.UuidNewV4().String(),
+		ConversationId: bot.UuidNewV4().String(),
+		RecipientId:    userId,
+		Category:       models.MessageCategoryPlainText,
+		Data:           data,
+	}
+	err = sendDistributedMessges(ctx, "shard", []*models.DistributedMessage{dm})
+	assert.Nil(err)
+	messages := fake.Messages()
+	assert.Len(messages, 1)
+	assert.Equal(dm.MessageId, messages[0]["message_id"])
+
+	attachmentId := bot.UuidNewV4().String()
+	_, err = session.Transport(ctx).ShowAttachment(ctx, attachmentId)
+	assert.NotNil(err)
+	fake.AddAttachment(attachmentId, []byte("image"))
+	attachment, err := session.Transport(ctx).ShowAttachment(ctx, attachmentId)
+	assert.Nil(err)
+	assert.Equal(attachmentId, attachment.AttachmentId)
+}
@@ -16,6 +16,7 @@ type Hub struct {
 func NewHub(db *durable.Database) *Hub {
 	hub := &Hub{services: make(map[string]Service)}
 	hub.context = session.WithDatabase(context.Background(), db)
+	hub.context = session.WithTransport(hub.context, durable.NewMixinTransport())
 	hub.registerServices()
 	return hub
 }
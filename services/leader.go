@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+// singletonLoops would process the same rows twice in two message service
+// processes, they run only in the leader, while the shards are spread across
+// all the processes.
+func singletonLoops() []func(context.Context) {
+	loops := []func(context.Context){
+		loopPendingMessages,
+		handlePendingParticipants,
+		handleExpiredPackets,
+		handlePendingRewards,
+		handlePendingRefunds,
+		handlePendingReferralRewards,
+		loopPendingSuccessMessages,
+		loopScheduledMessages,
+		loopSubscriptions,
+	}
+	if config.AppConfig.System.ImmediateDeleteExpiredDistributedMsgEnable {
+		loops = append(loops, clearUpExpiredDistributedMessages)
+	}
+	return loops
+}
+
+// lead elects the leader by the lease in PostgreSQL, the leader stops the
+// loops when the lease is taken over, or not renewed before half of the ttl,
+// so that two leaders hardly overlap.
+func lead(ctx context.Context, instanceId string) {
+	var cancel context.CancelFunc
+	var renewedAt time.Time
+	for {
+		leader, err := models.AcquireLease(ctx, models.LeaseLeader, instanceId, leaseTTL)
+		if err != nil {
+			session.Logger(ctx).Errorf("lead AcquireLease ERROR: %+v", err)
+		} else if leader {
+			renewedAt = time.Now()
+		}
+		if cancel == nil && leader {
+			session.Logger(ctx).Infof("LEADER ELECTED %s", instanceId)
+			var leaderCtx context.Context
+			leaderCtx, cancel = context.WithCancel(ctx)
+			for _, loop := range singletonLoops() {
+				go loop(leaderCtx)
+			}
+		} else if cancel != nil && (err == nil && !leader || time.Since(renewedAt) > leaseTTL/2) {
+			session.Logger(ctx).Infof("LEADER RESIGNED %s", instanceId)
+			cancel()
+			cancel = nil
+		}
+		time.Sleep(leaseRenewal)
+	}
+}
@@ -13,10 +13,10 @@ import (
 	"unicode/utf8"
 
 	"github.com/MixinNetwork/bot-api-go-client"
-	"github.com/MixinNetwork/go-number"
 	"github.com/gorilla/websocket"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/interceptors"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 )
@@ -73,12 +73,19 @@ type MessageContext struct {
 }
 
 func (service *MessageService) Run(ctx context.Context) error {
+	err := interceptors.LoadModerator(config.AppConfig.Moderation.Rules)
+	if err != nil {
+		return err
+	}
+	err = models.LoadRoles(ctx)
+	if err != nil {
+		return err
+	}
+
 	go distribute(ctx)
-	go loopPendingMessages(ctx)
-	go handlePendingParticipants(ctx)
-	go handleExpiredPackets(ctx)
-	go handlePendingRewards(ctx)
-	go loopPendingSuccessMessages(ctx)
+	go lead(ctx, serviceInstanceId)
+	go loopRoles(ctx)
+	go loopMessageReceipts(ctx)
 
 	for {
 		err := service.loop(ctx)
@@ -88,17 +95,10 @@ func (service *MessageService) Run(ctx context.Context) error {
 		session.Logger(ctx).Info("connection loop end")
 		time.Sleep(300 * time.Millisecond)
 	}
-	return nil
 }
 
-func (service *MessageService) loop(ctx context.Context) error {
-	conn, err := ConnectMixinBlaze(config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	mc := &MessageContext{
+func newMessageContext() *MessageContext {
+	return &MessageContext{
 		Transactions:   newTmap(),
 		ReadDone:       make(chan bool, 1),
 		WriteDone:      make(chan bool, 1),
@@ -107,7 +107,16 @@ func (service *MessageService) loop(ctx context.Context) error {
 		WriteBuffer:    make(chan []byte, 102400),
 		RecipientId:    make(map[string]time.Time, 0),
 	}
+}
 
+func (service *MessageService) loop(ctx context.Context) error {
+	conn, err := session.Transport(ctx).ConnectBlaze(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	mc := newMessageContext()
 	go writePump(ctx, conn, mc)
 	go readPump(ctx, conn, mc)
 
@@ -296,7 +305,8 @@ func parseMessage(ctx context.Context, mc *MessageContext, wsReader io.Reader) e
 			session.Logger(ctx).Error("ACKNOWLEDGE_MESSAGE_RECEIPT json.Unmarshal", err)
 			return nil
 		}
-		if msg.Status != "READ" {
+		messageReceipts.add(msg.MessageId, msg.Status)
+		if msg.Status != models.MessageReceiptRead {
 			return nil
 		}
 		id, err := models.FindDistributedMessageRecipientId(ctx, msg.MessageId)
@@ -342,7 +352,7 @@ func parseMessage(ctx context.Context, mc *MessageContext, wsReader io.Reader) e
 func handleTransfer(ctx context.Context, mc *MessageContext, transfer TransferView, userId string) error {
 	id, err := bot.UuidFromString(transfer.TraceId)
 	if err != nil {
-		return nil
+		return models.CreateRefund(ctx, transfer.SnapshotId, userId, transfer.AssetId, transfer.Amount, models.RefundReasonUntraced)
 	}
 	if data, _ := base64.StdEncoding.DecodeString(transfer.Memo); len(data) > 0 {
 		array := strings.Split(string(data), ":")
@@ -352,17 +362,23 @@ func handleTransfer(ctx context.Context, mc *MessageContext, transfer TransferVi
 		}
 	}
 	user, err := models.FindUser(ctx, userId)
-	if user == nil || err != nil {
+	if err != nil {
 		return err
 	}
-	if user.TraceId == transfer.TraceId {
-		for _, asset := range config.AppConfig.System.AccpetPaymentAssetList {
-			if number.FromString(transfer.Amount).Equal(number.FromString(asset.Amount).RoundFloor(8)) && transfer.AssetId == asset.AssetId {
-				return user.Payment(ctx)
-			}
-		}
-	} else if packet, err := models.PayPacket(ctx, id.String(), transfer.AssetId, transfer.Amount); err != nil || packet == nil {
+	if user != nil && user.TraceId == transfer.TraceId {
+		return user.Payment(ctx, &models.Payment{
+			SnapshotId: transfer.SnapshotId,
+			TraceId:    transfer.TraceId,
+			AssetId:    transfer.AssetId,
+			Amount:     transfer.Amount,
+			CreatedAt:  transfer.CreatedAt,
+		})
+	} else if packet, err := models.PayPacket(ctx, id.String(), transfer.AssetId, transfer.Amount); err != nil {
 		return err
+	} else if packet == nil {
+		return models.CreateRefund(ctx, transfer.SnapshotId, userId, transfer.AssetId, transfer.Amount, models.RefundReasonUntraced)
+	} else if packet.State == models.PacketStateInitial {
+		return models.CreateRefund(ctx, transfer.SnapshotId, userId, transfer.AssetId, transfer.Amount, models.RefundReasonPacket)
 	} else if packet.State == models.PacketStatePaid {
 		return sendPacketAppCard(ctx, mc, packet)
 	}
@@ -398,7 +414,7 @@ func sendPacketAppCard(ctx context.Context, mc *MessageContext, packet *models.P
 
 func handleExpiredPackets(ctx context.Context) {
 	var limit = 100
-	for {
+	for ctx.Err() == nil {
 		packetIds, err := models.ListExpiredPackets(ctx, limit)
 		if err != nil {
 			session.Logger(ctx).Error(err)
@@ -426,7 +442,7 @@ func handleExpiredPackets(ctx context.Context) {
 
 func handlePendingRewards(ctx context.Context) {
 	var limit = 20
-	for {
+	for ctx.Err() == nil {
 		rewards, err := models.PendingRewards(ctx, limit)
 		if err != nil {
 			session.Logger(ctx).Error(err)
@@ -449,9 +465,59 @@ func handlePendingRewards(ctx context.Context) {
 	}
 }
 
+func handlePendingRefunds(ctx context.Context) {
+	var limit = 20
+	for ctx.Err() == nil {
+		refunds, err := models.PendingRefunds(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			time.Sleep(300 * time.Millisecond)
+			continue
+		}
+
+		for _, refund := range refunds {
+			err = models.SendRefundTransfer(ctx, refund)
+			if err != nil {
+				session.Logger(ctx).Error(refund.SnapshotId, err)
+				continue
+			}
+		}
+
+		if len(refunds) < limit {
+			time.Sleep(10 * time.Second)
+			continue
+		}
+	}
+}
+
+func handlePendingReferralRewards(ctx context.Context) {
+	var limit = 20
+	for ctx.Err() == nil {
+		rewards, err := models.PendingReferralRewards(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			time.Sleep(300 * time.Millisecond)
+			continue
+		}
+
+		for _, reward := range rewards {
+			err = models.SendReferralRewardTransfer(ctx, reward)
+			if err != nil {
+				session.Logger(ctx).Error(reward.SnapshotId, err)
+				continue
+			}
+		}
+
+		if len(rewards) < limit {
+			time.Sleep(10 * time.Second)
+			continue
+		}
+	}
+}
+
 func handlePendingParticipants(ctx context.Context) {
 	var limit = 100
-	for {
+	for ctx.Err() == nil {
 		participants, err := models.ListPendingParticipants(ctx, limit)
 		if err != nil {
 			session.Logger(ctx).Error(err)
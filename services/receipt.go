@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	receiptFlushInterval = time.Second
+	receiptFlushLimit    = 500
+)
+
+// receiptBuffer collects the ACKNOWLEDGE_MESSAGE_RECEIPT from the Blaze read
+// loop, they are flushed in batches by the receipt, so that the hot
+// distributed_messages table is not written once per frame.
+type receiptBuffer struct {
+	mutex    sync.Mutex
+	receipts map[string][]string
+}
+
+var messageReceipts = newReceiptBuffer()
+
+func newReceiptBuffer() *receiptBuffer {
+	return &receiptBuffer{receipts: make(map[string][]string)}
+}
+
+func (b *receiptBuffer) add(messageId, receipt string) {
+	switch receipt {
+	case models.MessageReceiptDelivered, models.MessageReceiptRead:
+	default:
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.receipts[receipt] = append(b.receipts[receipt], messageId)
+}
+
+func (b *receiptBuffer) take() map[string][]string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	receipts := b.receipts
+	b.receipts = make(map[string][]string)
+	return receipts
+}
+
+// flush puts the receipts failed to update back, they are tried again in the
+// next interval.
+func (b *receiptBuffer) flush(ctx context.Context) error {
+	for receipt, ids := range b.take() {
+		for len(ids) > 0 {
+			n := len(ids)
+			if n > receiptFlushLimit {
+				n = receiptFlushLimit
+			}
+			err := models.UpdateDistributedMessagesReceipt(ctx, receipt, ids[:n])
+			if err != nil {
+				for _, id := range ids {
+					b.add(id, receipt)
+				}
+				return err
+			}
+			ids = ids[n:]
+		}
+	}
+	return nil
+}
+
+func loopMessageReceipts(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(receiptFlushInterval)
+		if err := messageReceipts.flush(ctx); err != nil {
+			session.Logger(ctx).Errorf("loopMessageReceipts ERROR: %+v", err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiptBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := newReceiptBuffer()
+	buffer.add("a", models.MessageReceiptDelivered)
+	buffer.add("b", models.MessageReceiptDelivered)
+	buffer.add("a", models.MessageReceiptRead)
+	buffer.add("c", "SENT")
+	receipts := buffer.take()
+	assert.Len(receipts, 2)
+	assert.Equal([]string{"a", "b"}, receipts[models.MessageReceiptDelivered])
+	assert.Equal([]string{"a"}, receipts[models.MessageReceiptRead])
+	assert.Len(buffer.take(), 0)
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	leaseTTL     = 30 * time.Second
+	leaseRenewal = 10 * time.Second
+)
+
+// serviceInstanceId identifies this message service process in the leases.
+var serviceInstanceId = bot.UuidNewV4().String()
+
+// rebalanceShards keeps this process alive in the leases, and runs the workers
+// of at most its fair share of the shards, the shards above the share or not
+// renewed are stopped, so that the other processes could take them over.
+func rebalanceShards(ctx context.Context, instanceId string, workers map[string]context.CancelFunc) error {
+	_, err := models.AcquireLease(ctx, models.LeasePrefixInstance+instanceId, instanceId, leaseTTL)
+	if err != nil {
+		return err
+	}
+	shards, err := models.MessageShards(ctx)
+	if err != nil {
+		return err
+	}
+	instances, err := models.ReadLeases(ctx, models.LeasePrefixInstance)
+	if err != nil {
+		return err
+	}
+	share := fairShardShare(len(shards), len(instances))
+	outboundThrottle.share(len(instances))
+
+	current := make(map[string]bool)
+	for _, shard := range shards {
+		current[shard] = true
+	}
+	owned := make([]string, 0, len(workers))
+	for shard := range workers {
+		owned = append(owned, shard)
+	}
+	sort.Strings(owned)
+	count := 0
+	for _, shard := range owned {
+		if current[shard] && count < share {
+			renewed, err := models.AcquireLease(ctx, models.LeasePrefixShard+shard, instanceId, leaseTTL)
+			if err != nil {
+				session.Logger(ctx).Errorf("rebalanceShards AcquireLease ERROR: %+v", err)
+			}
+			if err != nil || renewed {
+				count++
+				continue
+			}
+		}
+		workers[shard]()
+		delete(workers, shard)
+		err := models.ReleaseLease(ctx, models.LeasePrefixShard+shard, instanceId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, shard := range shards {
+		if count >= share {
+			break
+		}
+		if workers[shard] != nil {
+			continue
+		}
+		acquired, err := models.AcquireLease(ctx, models.LeasePrefixShard+shard, instanceId, leaseTTL)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			continue
+		}
+		workerCtx, cancel := context.WithCancel(ctx)
+		workers[shard] = cancel
+		count++
+		go pendingActiveDistributedMessages(workerCtx, shard, distributeLimit)
+	}
+
+	migrating, err := models.AcquireLease(ctx, models.LeaseShardMigration, instanceId, leaseTTL)
+	if err != nil || !migrating {
+		return err
+	}
+	for deadline := time.Now().Add(leaseRenewal); time.Now().Before(deadline); {
+		n, err := models.MigrateDistributedMessages(ctx)
+		if err != nil || n < models.ShardMigrationLimit {
+			return err
+		}
+	}
+	return nil
+}
+
+// fairShardShare rounds up, so that all the shards are owned even when the
+// shards are not divisible by the processes.
+func fairShardShare(shards, instances int) int {
+	if instances < 1 {
+		instances = 1
+	}
+	return (shards + instances - 1) / instances
+}
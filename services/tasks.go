@@ -2,19 +2,11 @@ package services
 
 import (
 	"context"
-	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"math/big"
-	"net/http"
-	"strings"
 	"time"
 
 	"github.com/MixinNetwork/bot-api-go-client"
-	"github.com/gofrs/uuid"
-	"mvdan.cc/xurls"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/interceptors"
@@ -22,13 +14,9 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 )
 
-type Attachment struct {
-	AttachmentId string `json:"attachment_id"`
-}
-
 func loopPendingMessages(ctx context.Context) {
 	limit := 5
-	for {
+	for ctx.Err() == nil {
 		messages, err := models.PendingMessages(ctx, int64(limit))
 		if err != nil {
 			time.Sleep(500 * time.Millisecond)
@@ -36,28 +24,22 @@ func loopPendingMessages(ctx context.Context) {
 			continue
 		}
 		for _, message := range messages {
-			if !config.AppConfig.System.Operators[message.UserId] && !config.AppConfig.System.WhiteMap[message.UserId] {
-				if config.AppConfig.System.DetectLinkEnabled && message.Category == "PLAIN_TEXT" {
-					data, err := base64.StdEncoding.DecodeString(message.Data)
-					if err != nil {
-						session.Logger(ctx).Errorf("DetectLink ERROR: %+v", err)
+			if message.State != models.MessageStateApproved && models.UserRole(message.UserId) == models.RoleUser {
+				if action, reason := interceptors.Moderate(ctx, message); action != interceptors.ActionAllow {
+					var err error
+					switch action {
+					case interceptors.ActionReject:
+						err = message.Reject(ctx)
+					case interceptors.ActionHold:
+						err = message.Hold(ctx, reason)
+					default:
+						err = message.Leapfrog(ctx, reason)
 					}
-					if xurls.Relaxed.Match(data) {
-						if err := message.Leapfrog(ctx, "Message contains link"); err != nil {
-							time.Sleep(500 * time.Millisecond)
-							session.Logger(ctx).Errorf("PendingMessages ERROR: %+v", err)
-						}
-						continue
-					}
-				}
-				if config.AppConfig.System.DetectQRCodeEnabled && message.Category == "PLAIN_IMAGE" {
-					if b, reason := validateMessage(ctx, message); !b {
-						if err := message.Leapfrog(ctx, reason); err != nil {
-							time.Sleep(500 * time.Millisecond)
-							session.Logger(ctx).Errorf("PendingMessages ERROR: %+v", err)
-						}
-						continue
+					if err != nil {
+						time.Sleep(500 * time.Millisecond)
+						session.Logger(ctx).Errorf("PendingMessages ERROR: %+v", err)
 					}
+					continue
 				}
 			}
 			if err := message.Distribute(ctx); err != nil {
@@ -73,7 +55,7 @@ func loopPendingMessages(ctx context.Context) {
 }
 
 func loopPendingSuccessMessages(ctx context.Context) {
-	for {
+	for ctx.Err() == nil {
 		count, err := models.LoopClearUpSuccessMessages(ctx)
 		if err != nil {
 			time.Sleep(500 * time.Millisecond)
@@ -86,6 +68,54 @@ func loopPendingSuccessMessages(ctx context.Context) {
 	}
 }
 
+func loopScheduledMessages(ctx context.Context) {
+	limit := 10
+	for ctx.Err() == nil {
+		schedules, err := models.DueScheduledMessages(ctx, limit)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("ScheduledMessages ERROR: %+v", err)
+			continue
+		}
+		for _, s := range schedules {
+			if err := s.Publish(ctx); err != nil {
+				time.Sleep(500 * time.Millisecond)
+				session.Logger(ctx).Errorf("ScheduledMessages ERROR: %+v", err)
+			}
+		}
+		if len(schedules) < limit {
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
+
+func loopSubscriptions(ctx context.Context) {
+	limit := 100
+	for ctx.Err() == nil {
+		if _, err := models.WarnExpiringSubscriptions(ctx, limit); err != nil {
+			session.Logger(ctx).Errorf("WarnExpiringSubscriptions ERROR: %+v", err)
+		}
+		count, err := models.DowngradeExpiredSubscriptions(ctx, limit)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("DowngradeExpiredSubscriptions ERROR: %+v", err)
+			continue
+		}
+		if count < limit {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopRoles(ctx context.Context) {
+	for {
+		time.Sleep(models.RolesCacheTTL)
+		if err := models.LoadRoles(ctx); err != nil {
+			session.Logger(ctx).Errorf("LoadRoles ERROR: %+v", err)
+		}
+	}
+}
+
 func sendTextMessage(ctx context.Context, mc *MessageContext, conversationId, label string) error {
 	params := map[string]interface{}{
 		"conversation_id": conversationId,
@@ -167,71 +197,3 @@ func sendRawAppCard(ctx context.Context, mc *MessageContext, conversationId stri
 	}
 	return nil
 }
-
-func validateMessage(ctx context.Context, message *models.Message) (bool, string) {
-	var a Attachment
-	src, err := base64.StdEncoding.DecodeString(message.Data)
-	if err != nil {
-		return false, "message.Data format error is not Base64"
-	}
-	err = json.Unmarshal(src, &a)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return false, "message.Data Unmarshal error"
-	}
-	attachment, err := bot.AttachemntShow(ctx, config.AppConfig.Mixin.ClientId, config.AppConfig.Mixin.SessionId, config.AppConfig.Mixin.SessionKey, a.AttachmentId)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return false, fmt.Sprintf("bot.AttachemntShow error: %+v, id: %s", err, a.AttachmentId)
-	}
-
-	url := strings.Replace(attachment.ViewURL, "assets.zeromesh.net", "s3.cn-north-1.amazonaws.com.cn", 0)
-	session.Logger(ctx).Infof("validateMessage attachment ViewURL %s", url)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return true, ""
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-	resp, _ := http.DefaultClient.Do(req.WithContext(ctx))
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return true, ""
-	}
-	defer resp.Body.Close()
-	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		session.Logger(ctx).Errorf("validateMessage StatusCode ERROR: %d", resp.StatusCode)
-		return true, ""
-	}
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return true, ""
-	}
-	if b, err := interceptors.CheckQRCode(ctx, data); b {
-		if err != nil {
-			return true, ""
-		}
-		return false, "Image contains QR Code"
-	}
-	if b, err := interceptors.CheckSex(ctx, data); b {
-		return false, fmt.Sprintf("CheckSex: %+v", err)
-	}
-	return true, ""
-}
-
-func shardId(modifier string, i int64) string {
-	h := md5.New()
-	h.Write([]byte(modifier))
-	h.Write(new(big.Int).SetInt64(i).Bytes())
-	s := h.Sum(nil)
-	s[6] = (s[6] & 0x0f) | 0x30
-	s[8] = (s[8] & 0x3f) | 0x80
-	id, err := uuid.FromBytes(s)
-	if err != nil {
-		panic(err)
-	}
-	return id.String()
-}
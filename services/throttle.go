@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultMessageRateLimit = 200
+	minimumMessageRate      = 1
+	messageThrottleInterval = 5 * time.Second
+)
+
+// messageThrottle is the token bucket of the messages posted to the API,
+// shared by all the shards of the process. The rate limit of the group is
+// divided by the live processes, the rate halves when the API throttles, and
+// recovers by a twentieth of the ceiling every quiet interval.
+type messageThrottle struct {
+	mutex       sync.Mutex
+	limiter     *rate.Limiter
+	total       float64
+	instances   int
+	throttled   bool
+	throttledAt time.Time
+	sent        int64
+	sampled     int64
+	sampledAt   time.Time
+	throughput  float64
+}
+
+// MessageThrottleStats is published as message_throttle in /debug/vars of
+// the message service.
+type MessageThrottleStats struct {
+	Limit       float64   `json:"limit"`
+	Ceiling     float64   `json:"ceiling"`
+	Throughput  float64   `json:"throughput"`
+	Sent        int64     `json:"sent"`
+	ThrottledAt time.Time `json:"throttled_at"`
+}
+
+var outboundThrottle = newMessageThrottle()
+
+func init() {
+	expvar.Publish("message_throttle", expvar.Func(func() interface{} {
+		return outboundThrottle.stats()
+	}))
+}
+
+func newMessageThrottle() *messageThrottle {
+	return &messageThrottle{
+		limiter:   rate.NewLimiter(rate.Inf, distributeLimit),
+		instances: 1,
+		sampledAt: time.Now(),
+	}
+}
+
+// configure sets the rate limit of the group, it's not limited before.
+func (t *messageThrottle) configure(total int64) {
+	if total <= 0 {
+		total = defaultMessageRateLimit
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.total = float64(total)
+	t.limiter.SetLimit(rate.Limit(t.ceiling()))
+}
+
+// share divides the rate limit of the group by the live processes.
+func (t *messageThrottle) share(instances int) {
+	if instances < 1 {
+		instances = 1
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.instances = instances
+	if ceiling := rate.Limit(t.ceiling()); t.limiter.Limit() > ceiling {
+		t.limiter.SetLimit(ceiling)
+	}
+}
+
+func (t *messageThrottle) ceiling() float64 {
+	if t.total <= 0 {
+		return float64(rate.Inf)
+	}
+	ceiling := t.total / float64(t.instances)
+	if ceiling < minimumMessageRate {
+		return minimumMessageRate
+	}
+	return ceiling
+}
+
+func (t *messageThrottle) wait(ctx context.Context, n int) error {
+	return t.limiter.WaitN(ctx, n)
+}
+
+// done records the messages posted, and halves the rate when the API
+// responds with 429, at most once an interval, because the shards throttled
+// at the same time are all responding to the same limit.
+func (t *messageThrottle) done(ctx context.Context, n int, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err == nil {
+		t.sent += int64(n)
+		return
+	}
+	if e, ok := err.(bot.Error); !ok || e.Code != 429 || t.total <= 0 {
+		return
+	}
+	if time.Since(t.throttledAt) < messageThrottleInterval {
+		return
+	}
+	limit := float64(t.limiter.Limit()) / 2
+	if limit < minimumMessageRate {
+		limit = minimumMessageRate
+	}
+	t.limiter.SetLimit(rate.Limit(limit))
+	t.throttled, t.throttledAt = true, time.Now()
+	session.Logger(ctx).Infof("MESSAGE THROTTLED %.2f/s", limit)
+}
+
+// adapt samples the throughput, and raises the rate when the API didn't
+// throttle since the last interval.
+func (t *messageThrottle) adapt() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if elapsed := now.Sub(t.sampledAt).Seconds(); elapsed > 0 {
+		t.throughput = float64(t.sent-t.sampled) / elapsed
+		t.sampled, t.sampledAt = t.sent, now
+	}
+	if t.throttled {
+		t.throttled = false
+		return
+	}
+	ceiling := t.ceiling()
+	limit := float64(t.limiter.Limit()) + ceiling/20
+	if limit > ceiling {
+		limit = ceiling
+	}
+	t.limiter.SetLimit(rate.Limit(limit))
+}
+
+func (t *messageThrottle) stats() MessageThrottleStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := MessageThrottleStats{
+		Limit:       float64(t.limiter.Limit()),
+		Ceiling:     t.ceiling(),
+		Throughput:  t.throughput,
+		Sent:        t.sent,
+		ThrottledAt: t.throttledAt,
+	}
+	if t.total <= 0 {
+		s.Limit, s.Ceiling = 0, 0
+	}
+	return s
+}
+
+func loopMessageThrottle(ctx context.Context) {
+	for ctx.Err() == nil {
+		time.Sleep(messageThrottleInterval)
+		outboundThrottle.adapt()
+	}
+}
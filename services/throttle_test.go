@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageThrottle(t *testing.T) {
+	assert := assert.New(t)
+	config.AppConfig = &config.Config{}
+	fake := NewFakeTransport()
+	defer fake.Close()
+	ctx := session.WithLogger(context.Background(), durable.BuildLogger())
+	ctx = session.WithTransport(ctx, fake)
+
+	throttle := newMessageThrottle()
+	defer func(t *messageThrottle) { outboundThrottle = t }(outboundThrottle)
+	outboundThrottle = throttle
+	assert.Equal(float64(0), throttle.stats().Limit)
+
+	throttle.configure(0)
+	assert.Equal(float64(defaultMessageRateLimit), throttle.stats().Limit)
+	throttle.configure(400)
+	throttle.share(2)
+	assert.Equal(float64(200), throttle.stats().Limit)
+	assert.Equal(float64(200), throttle.stats().Ceiling)
+
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+	messages := make([]*models.DistributedMessage, 10)
+	for i := range messages {
+		messages[i] = &models.DistributedMessage{
+			MessageId:      bot.UuidNewV4().String(),
+			ConversationId: bot.UuidNewV4().String(),
+			RecipientId:    bot.UuidNewV4().String(),
+			Category:       models.MessageCategoryPlainText,
+			Data:           data,
+		}
+	}
+	fake.Throttle(2)
+	delivered, rejected, err := bisectDistributedMessages(ctx, "shard", messages)
+	assert.NotNil(err)
+	assert.False(distributedMessagesRejected(err))
+	assert.Len(delivered, 0)
+	assert.Len(rejected, 0)
+	assert.Equal(float64(100), throttle.stats().Limit)
+	err = sendDistributedMessges(ctx, "shard", messages)
+	assert.NotNil(err)
+	assert.Equal(float64(100), throttle.stats().Limit)
+	assert.False(throttle.stats().ThrottledAt.IsZero())
+	throttle.throttledAt = time.Now().Add(-messageThrottleInterval)
+	throttle.done(ctx, len(messages), bot.Error{Status: 429, Code: 429})
+	assert.Equal(float64(50), throttle.stats().Limit)
+	err = sendDistributedMessges(ctx, "shard", messages)
+	assert.Nil(err)
+	assert.Equal(int64(10), throttle.stats().Sent)
+	assert.Len(fake.Messages(), 10)
+
+	throttle.adapt()
+	assert.Equal(float64(50), throttle.stats().Limit)
+	assert.True(throttle.stats().Throughput > 0)
+	throttle.adapt()
+	assert.Equal(float64(60), throttle.stats().Limit)
+	for i := 0; i < 30; i++ {
+		throttle.adapt()
+	}
+	assert.Equal(float64(200), throttle.stats().Limit)
+	throttle.share(4)
+	assert.Equal(float64(100), throttle.stats().Limit)
+}
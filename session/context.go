@@ -16,6 +16,7 @@ const (
 	keyDatabase          contextValueKey = 1
 	keyLogger            contextValueKey = 2
 	keyRender            contextValueKey = 3
+	keyTransport         contextValueKey = 4
 	keyRemoteAddress     contextValueKey = 11
 	keyAuthorizationInfo contextValueKey = 12
 	keyRequestBody       contextValueKey = 13
@@ -31,6 +32,11 @@ func Database(ctx context.Context) *durable.Database {
 	return v
 }
 
+func Transport(ctx context.Context) durable.Transport {
+	v, _ := ctx.Value(keyTransport).(durable.Transport)
+	return v
+}
+
 func Render(ctx context.Context) *render.Render {
 	v, _ := ctx.Value(keyRender).(*render.Render)
 	return v
@@ -64,6 +70,10 @@ func WithDatabase(ctx context.Context, database *durable.Database) context.Conte
 	return context.WithValue(ctx, keyDatabase, database)
 }
 
+func WithTransport(ctx context.Context, transport durable.Transport) context.Context {
+	return context.WithValue(ctx, keyTransport, transport)
+}
+
 func WithRender(ctx context.Context, render *render.Render) context.Context {
 	return context.WithValue(ctx, keyRender, render)
 }
@@ -0,0 +1,34 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type AuditLogView struct {
+	Type       string    `json:"type"`
+	LogId      string    `json:"log_id"`
+	OperatorId string    `json:"operator_id"`
+	Action     string    `json:"action"`
+	TargetId   string    `json:"target_id"`
+	Detail     string    `json:"detail"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func RenderAuditLogs(w http.ResponseWriter, r *http.Request, logs []*models.AuditLog) {
+	views := make([]AuditLogView, len(logs))
+	for i, l := range logs {
+		views[i] = AuditLogView{
+			Type:       "audit_log",
+			LogId:      l.LogId,
+			OperatorId: l.OperatorId,
+			Action:     l.Action,
+			TargetId:   l.TargetId,
+			Detail:     l.Detail,
+			CreatedAt:  l.CreatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
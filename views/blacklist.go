@@ -0,0 +1,35 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type BlacklistView struct {
+	Type           string    `json:"type"`
+	UserId         string    `json:"user_id"`
+	IdentityNumber string    `json:"identity_number"`
+	FullName       string    `json:"full_name"`
+	OperatorId     string    `json:"operator_id"`
+	Reason         string    `json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func RenderBlacklists(w http.ResponseWriter, r *http.Request, blacklists []*models.Blacklist) {
+	views := make([]BlacklistView, len(blacklists))
+	for i, b := range blacklists {
+		views[i] = BlacklistView{
+			Type:           "blacklist",
+			UserId:         b.UserId,
+			IdentityNumber: fmt.Sprint(b.IdentityNumber),
+			FullName:       b.FullName,
+			OperatorId:     b.OperatorId,
+			Reason:         b.Reason,
+			CreatedAt:      b.CreatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,49 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type InvitationView struct {
+	Type      string    `json:"type"`
+	Code      string    `json:"code"`
+	CreatorId string    `json:"creator_id"`
+	Plan      string    `json:"plan"`
+	Discount  int64     `json:"discount"`
+	MaxUses   int64     `json:"max_uses"`
+	UsedCount int64     `json:"used_count"`
+	ExpiredAt string    `json:"expired_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func buildInvitationView(i *models.Invitation) InvitationView {
+	view := InvitationView{
+		Type:      "invitation",
+		Code:      i.Code,
+		CreatorId: i.CreatorId,
+		Plan:      i.Plan,
+		Discount:  i.Discount,
+		MaxUses:   i.MaxUses,
+		UsedCount: i.UsedCount,
+		CreatedAt: i.CreatedAt,
+	}
+	if !i.ExpiredAt.IsZero() {
+		view.ExpiredAt = i.ExpiredAt.Format(time.RFC3339Nano)
+	}
+	return view
+}
+
+func RenderInvitation(w http.ResponseWriter, r *http.Request, invitation *models.Invitation) {
+	RenderDataResponse(w, r, buildInvitationView(invitation))
+}
+
+func RenderInvitations(w http.ResponseWriter, r *http.Request, invitations []*models.Invitation) {
+	views := make([]InvitationView, len(invitations))
+	for i, invitation := range invitations {
+		views[i] = buildInvitationView(invitation)
+	}
+	RenderDataResponse(w, r, views)
+}
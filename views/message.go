@@ -5,32 +5,96 @@ import (
 	"time"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
 )
 
 type MessageView struct {
-	Type      string    `json:"type"`
-	MessageId string    `json:"message_id"`
-	Category  string    `json:"category"`
-	Data      string    `json:"data"`
-	FullName  string    `json:"full_name"`
-	CreatedAt time.Time `json:"created_at"`
+	Type           string    `json:"type"`
+	MessageId      string    `json:"message_id"`
+	UserId         string    `json:"user_id"`
+	Category       string    `json:"category"`
+	QuoteMessageId string    `json:"quote_message_id"`
+	ThreadId       string    `json:"thread_id"`
+	Data           string    `json:"data"`
+	FullName       string    `json:"full_name"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	Delivery *MessageDeliveryView `json:"delivery,omitempty"`
+}
+
+type MessageDeliveryView struct {
+	Queued    int64 `json:"queued"`
+	Sent      int64 `json:"sent"`
+	Delivered int64 `json:"delivered"`
+	Read      int64 `json:"read"`
+	Failed    int64 `json:"failed"`
+}
+
+type ThreadView struct {
+	Type        string        `json:"type"`
+	ThreadId    string        `json:"thread_id"`
+	ReplyCount  int64         `json:"reply_count"`
+	LastReplyAt time.Time     `json:"last_reply_at"`
+	Followed    bool          `json:"followed"`
+	Root        MessageView   `json:"root"`
+	Replies     []MessageView `json:"replies"`
 }
 
 func buildMessageView(message *models.Message) MessageView {
 	view := MessageView{
-		Type:      "message",
-		MessageId: message.MessageId,
-		Category:  message.Category,
-		Data:      message.Data,
-		FullName:  message.FullName.String,
-		CreatedAt: message.CreatedAt,
+		Type:           "message",
+		MessageId:      message.MessageId,
+		UserId:         message.UserId,
+		Category:       message.Category,
+		QuoteMessageId: message.QuoteMessageId,
+		ThreadId:       message.ThreadId,
+		Data:           message.Data,
+		FullName:       message.FullName.String,
+		CreatedAt:      message.CreatedAt,
 	}
 	if view.FullName == "" {
 		view.FullName = "NULL"
 	}
+	if d := message.Delivery; d != nil {
+		view.Delivery = &MessageDeliveryView{
+			Queued:    d.Queued,
+			Sent:      d.Sent,
+			Delivered: d.Delivered,
+			Read:      d.Read,
+			Failed:    d.Failed,
+		}
+	}
 	return view
 }
 
+type FailedMessageView struct {
+	Type        string    `json:"type"`
+	MessageId   string    `json:"message_id"`
+	ParentId    string    `json:"parent_id"`
+	RecipientId string    `json:"recipient_id"`
+	Category    string    `json:"category"`
+	Attempts    int64     `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func RenderFailedMessages(w http.ResponseWriter, r *http.Request, messages []*models.DistributedMessage) {
+	views := make([]FailedMessageView, len(messages))
+	for i, m := range messages {
+		views[i] = FailedMessageView{
+			Type:        "failed_message",
+			MessageId:   m.MessageId,
+			ParentId:    m.ParentId,
+			RecipientId: m.RecipientId,
+			Category:    m.Category,
+			Attempts:    m.Attempts,
+			LastError:   m.LastError,
+			CreatedAt:   m.CreatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
+
 func RenderMessages(w http.ResponseWriter, r *http.Request, messages []*models.Message) {
 	views := make([]MessageView, len(messages))
 	for i, message := range messages {
@@ -38,3 +102,27 @@ func RenderMessages(w http.ResponseWriter, r *http.Request, messages []*models.M
 	}
 	RenderDataResponse(w, r, views)
 }
+
+func RenderMessagesWithCursor(w http.ResponseWriter, r *http.Request, messages []*models.Message, next string) {
+	views := make([]MessageView, len(messages))
+	for i, message := range messages {
+		views[i] = buildMessageView(message)
+	}
+	session.Render(r.Context()).JSON(w, http.StatusOK, ResponseView{Data: views, Next: next})
+}
+
+func RenderThread(w http.ResponseWriter, r *http.Request, thread *models.Thread) {
+	replies := make([]MessageView, len(thread.Replies))
+	for i, message := range thread.Replies {
+		replies[i] = buildMessageView(message)
+	}
+	RenderDataResponse(w, r, ThreadView{
+		Type:        "thread",
+		ThreadId:    thread.ThreadId,
+		ReplyCount:  thread.ReplyCount,
+		LastReplyAt: thread.LastReplyAt,
+		Followed:    thread.Followed,
+		Root:        buildMessageView(thread.Root),
+		Replies:     replies,
+	})
+}
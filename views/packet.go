@@ -13,6 +13,10 @@ type PreparationView struct {
 		PariticipantsCount int64 `json:"participants_count"`
 	} `json:"conversation"`
 	Assets []AssetView `json:"assets"`
+	Expiry struct {
+		Minimum int64 `json:"minimum"`
+		Maximum int64 `json:"maximum"`
+	} `json:"expiry"`
 }
 
 type AssetView struct {
@@ -37,6 +41,7 @@ type ParticipantView struct {
 
 type PacketView struct {
 	Type            string            `json:"type"`
+	PacketType      string            `json:"packet_type"`
 	PacketId        string            `json:"packet_id"`
 	User            UserView          `json:"user"`
 	Asset           AssetView         `json:"asset"`
@@ -48,9 +53,32 @@ type PacketView struct {
 	OpenedCount     int64             `json:"opened_count"`
 	OpenedAmount    string            `json:"opened_amount"`
 	State           string            `json:"state"`
+	Rules           PacketRulesView   `json:"rules"`
+	CreatedAt       time.Time         `json:"created_at"`
+	ExpiredAt       time.Time         `json:"expired_at"`
 	Participants    []ParticipantView `json:"participants"`
 }
 
+type PacketRulesView struct {
+	UserIds      []string `json:"user_ids"`
+	JoinedBefore string   `json:"joined_before"`
+	ActiveDays   int64    `json:"active_days"`
+}
+
+func buildPacketRulesView(rules models.PacketRules) PacketRulesView {
+	view := PacketRulesView{
+		UserIds:    rules.UserIds,
+		ActiveDays: rules.ActiveDays,
+	}
+	if view.UserIds == nil {
+		view.UserIds = []string{}
+	}
+	if !rules.JoinedBefore.IsZero() {
+		view.JoinedBefore = rules.JoinedBefore.Format(time.RFC3339Nano)
+	}
+	return view
+}
+
 func buildAssetView(asset *models.Asset) AssetView {
 	return AssetView{
 		Type:     "asset",
@@ -88,12 +116,14 @@ func RenderPacketPreparation(w http.ResponseWriter, r *http.Request, participant
 		Assets: assetsView,
 	}
 	prepareView.Conversation.PariticipantsCount = participantsCount
+	prepareView.Expiry.Minimum, prepareView.Expiry.Maximum = models.PacketExpiryBounds()
 	RenderDataResponse(w, r, prepareView)
 }
 
 func RenderPacket(w http.ResponseWriter, r *http.Request, packet *models.Packet) {
 	packetView := PacketView{
 		Type:            "packet",
+		PacketType:      packet.Type,
 		PacketId:        packet.PacketId,
 		Asset:           buildAssetView(packet.Asset),
 		User:            buildUserView(packet.User),
@@ -105,7 +135,114 @@ func RenderPacket(w http.ResponseWriter, r *http.Request, packet *models.Packet)
 		OpenedCount:     packet.TotalCount - packet.RemainingCount,
 		OpenedAmount:    number.FromString(packet.Amount).Sub(number.FromString(packet.RemainingAmount)).Persist(),
 		State:           packet.State,
+		Rules:           buildPacketRulesView(packet.Rules),
+		CreatedAt:       packet.CreatedAt,
+		ExpiredAt:       packet.ExpiredAt,
 		Participants:    buildParticipantsView(packet.Participants),
 	}
 	RenderDataResponse(w, r, packetView)
 }
+
+type PacketHistoryView struct {
+	Sent     []PacketRecordView     `json:"sent"`
+	Received []ReceivedPacketView   `json:"received"`
+	Totals   []PacketAssetTotalView `json:"totals"`
+}
+
+type PacketRecordView struct {
+	Type            string    `json:"type"`
+	PacketId        string    `json:"packet_id"`
+	PacketType      string    `json:"packet_type"`
+	AssetId         string    `json:"asset_id"`
+	Amount          string    `json:"amount"`
+	Greeting        string    `json:"greeting"`
+	TotalCount      int64     `json:"total_count"`
+	RemainingCount  int64     `json:"remaining_count"`
+	RemainingAmount string    `json:"remaining_amount"`
+	State           string    `json:"state"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type ReceivedPacketView struct {
+	Type      string    `json:"type"`
+	PacketId  string    `json:"packet_id"`
+	SenderId  string    `json:"sender_id"`
+	AssetId   string    `json:"asset_id"`
+	Amount    string    `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PacketAssetTotalView struct {
+	AssetId        string `json:"asset_id"`
+	SentCount      int64  `json:"sent_count"`
+	SentAmount     string `json:"sent_amount"`
+	ReceivedCount  int64  `json:"received_count"`
+	ReceivedAmount string `json:"received_amount"`
+}
+
+type PacketRankView struct {
+	Type      string `json:"type"`
+	UserId    string `json:"user_id"`
+	FullName  string `json:"full_name"`
+	AvatarURL string `json:"avatar_url"`
+	Count     int64  `json:"count"`
+	AmountUSD string `json:"amount_usd"`
+}
+
+func RenderPacketHistory(w http.ResponseWriter, r *http.Request, history *models.PacketHistory) {
+	view := PacketHistoryView{
+		Sent:     make([]PacketRecordView, len(history.Sent)),
+		Received: make([]ReceivedPacketView, len(history.Received)),
+		Totals:   make([]PacketAssetTotalView, len(history.Totals)),
+	}
+	for i, p := range history.Sent {
+		view.Sent[i] = PacketRecordView{
+			Type:            "packet",
+			PacketId:        p.PacketId,
+			PacketType:      p.Type,
+			AssetId:         p.AssetId,
+			Amount:          p.Amount,
+			Greeting:        p.Greeting,
+			TotalCount:      p.TotalCount,
+			RemainingCount:  p.RemainingCount,
+			RemainingAmount: p.RemainingAmount,
+			State:           p.State,
+			CreatedAt:       p.CreatedAt,
+		}
+	}
+	for i, p := range history.Received {
+		view.Received[i] = ReceivedPacketView{
+			Type:      "participant",
+			PacketId:  p.PacketId,
+			SenderId:  p.SenderId,
+			AssetId:   p.AssetId,
+			Amount:    p.Amount,
+			CreatedAt: p.CreatedAt,
+		}
+	}
+	for i, t := range history.Totals {
+		view.Totals[i] = PacketAssetTotalView{
+			AssetId:        t.AssetId,
+			SentCount:      t.SentCount,
+			SentAmount:     t.SentAmount,
+			ReceivedCount:  t.ReceivedCount,
+			ReceivedAmount: t.ReceivedAmount,
+		}
+	}
+	RenderDataResponse(w, r, view)
+}
+
+func RenderPacketLeaderboard(w http.ResponseWriter, r *http.Request, ranks []*models.PacketRank) {
+	views := make([]PacketRankView, len(ranks))
+	for i, rank := range ranks {
+		views[i] = PacketRankView{
+			Type:      "packet_rank",
+			UserId:    rank.UserId,
+			FullName:  rank.FullName,
+			AvatarURL: rank.AvatarURL,
+			Count:     rank.Count,
+			AmountUSD: rank.AmountUSD,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,54 @@
+package views
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type PaymentView struct {
+	Type           string    `json:"type"`
+	SnapshotId     string    `json:"snapshot_id"`
+	UserId         string    `json:"user_id"`
+	TraceId        string    `json:"trace_id"`
+	AssetId        string    `json:"asset_id"`
+	Amount         string    `json:"amount"`
+	ExpectedAmount string    `json:"expected_amount"`
+	Plan           string    `json:"plan"`
+	Result         string    `json:"result"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func RenderPayments(w http.ResponseWriter, r *http.Request, payments []*models.Payment) {
+	views := make([]PaymentView, len(payments))
+	for i, p := range payments {
+		views[i] = PaymentView{
+			Type:           "payment",
+			SnapshotId:     p.SnapshotId,
+			UserId:         p.UserId,
+			TraceId:        p.TraceId,
+			AssetId:        p.AssetId,
+			Amount:         p.Amount,
+			ExpectedAmount: p.ExpectedAmount,
+			Plan:           p.Plan,
+			Result:         p.Result,
+			CreatedAt:      p.CreatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
+
+func RenderPaymentsCSV(w http.ResponseWriter, r *http.Request, payments []*models.Payment) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"payments-%s.csv\"", time.Now().Format("20060102150405")))
+	w.WriteHeader(http.StatusOK)
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"snapshot_id", "user_id", "trace_id", "asset_id", "amount", "expected_amount", "plan", "result", "created_at"})
+	for _, p := range payments {
+		writer.Write([]string{p.SnapshotId, p.UserId, p.TraceId, p.AssetId, p.Amount, p.ExpectedAmount, p.Plan, p.Result, p.CreatedAt.Format(time.RFC3339Nano)})
+	}
+	writer.Flush()
+}
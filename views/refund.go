@@ -0,0 +1,38 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type RefundView struct {
+	Type       string    `json:"type"`
+	SnapshotId string    `json:"snapshot_id"`
+	UserId     string    `json:"user_id"`
+	AssetId    string    `json:"asset_id"`
+	Amount     string    `json:"amount"`
+	Reason     string    `json:"reason"`
+	PaidAt     string    `json:"paid_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func RenderRefunds(w http.ResponseWriter, r *http.Request, refunds []*models.Refund) {
+	views := make([]RefundView, len(refunds))
+	for i, refund := range refunds {
+		views[i] = RefundView{
+			Type:       "refund",
+			SnapshotId: refund.SnapshotId,
+			UserId:     refund.UserId,
+			AssetId:    refund.AssetId,
+			Amount:     refund.Amount,
+			Reason:     refund.Reason,
+			CreatedAt:  refund.CreatedAt,
+		}
+		if !refund.PaidAt.IsZero() {
+			views[i].PaidAt = refund.PaidAt.Format(time.RFC3339Nano)
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
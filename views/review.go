@@ -0,0 +1,49 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type MessageReviewView struct {
+	Type       string      `json:"type"`
+	MessageId  string      `json:"message_id"`
+	UserId     string      `json:"user_id"`
+	Reason     string      `json:"reason"`
+	Decision   string      `json:"decision"`
+	ReviewerId string      `json:"reviewer_id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Message    MessageView `json:"message"`
+}
+
+func buildMessageReviewView(r *models.MessageReview) MessageReviewView {
+	view := MessageReviewView{
+		Type:       "message_review",
+		MessageId:  r.MessageId,
+		UserId:     r.UserId,
+		Reason:     r.Reason,
+		Decision:   r.Decision,
+		ReviewerId: r.ReviewerId,
+		CreatedAt:  r.CreatedAt,
+		UpdatedAt:  r.UpdatedAt,
+	}
+	if r.Message != nil {
+		view.Message = buildMessageView(r.Message)
+	}
+	return view
+}
+
+func RenderMessageReview(w http.ResponseWriter, r *http.Request, review *models.MessageReview) {
+	RenderDataResponse(w, r, buildMessageReviewView(review))
+}
+
+func RenderMessageReviews(w http.ResponseWriter, r *http.Request, reviews []*models.MessageReview) {
+	views := make([]MessageReviewView, len(reviews))
+	for i, review := range reviews {
+		views[i] = buildMessageReviewView(review)
+	}
+	RenderDataResponse(w, r, views)
+}
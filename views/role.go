@@ -0,0 +1,45 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type RoleView struct {
+	Type           string    `json:"type"`
+	UserId         string    `json:"user_id"`
+	IdentityNumber string    `json:"identity_number"`
+	FullName       string    `json:"full_name"`
+	Role           string    `json:"role"`
+	Permissions    []string  `json:"permissions"`
+	GrantedBy      string    `json:"granted_by"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func buildRoleView(role *models.Role) RoleView {
+	return RoleView{
+		Type:           "role",
+		UserId:         role.UserId,
+		IdentityNumber: fmt.Sprint(role.IdentityNumber),
+		FullName:       role.FullName,
+		Role:           role.Role,
+		Permissions:    role.Permissions,
+		GrantedBy:      role.GrantedBy,
+		UpdatedAt:      role.UpdatedAt,
+	}
+}
+
+func RenderRole(w http.ResponseWriter, r *http.Request, role *models.Role) {
+	RenderDataResponse(w, r, buildRoleView(role))
+}
+
+func RenderRoles(w http.ResponseWriter, r *http.Request, roles []*models.Role) {
+	views := make([]RoleView, len(roles))
+	for i, role := range roles {
+		views[i] = buildRoleView(role)
+	}
+	RenderDataResponse(w, r, views)
+}
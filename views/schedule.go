@@ -0,0 +1,48 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type ScheduledMessageView struct {
+	Type       string    `json:"type"`
+	ScheduleId string    `json:"schedule_id"`
+	UserId     string    `json:"user_id"`
+	Category   string    `json:"category"`
+	Data       string    `json:"data"`
+	Recurrence string    `json:"recurrence"`
+	NextAt     time.Time `json:"next_at"`
+	State      string    `json:"state"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func buildScheduledMessageView(s *models.ScheduledMessage) ScheduledMessageView {
+	return ScheduledMessageView{
+		Type:       "scheduled_message",
+		ScheduleId: s.ScheduleId,
+		UserId:     s.UserId,
+		Category:   s.Category,
+		Data:       s.Data,
+		Recurrence: s.Recurrence,
+		NextAt:     s.NextAt,
+		State:      s.State,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+	}
+}
+
+func RenderScheduledMessage(w http.ResponseWriter, r *http.Request, s *models.ScheduledMessage) {
+	RenderDataResponse(w, r, buildScheduledMessageView(s))
+}
+
+func RenderScheduledMessages(w http.ResponseWriter, r *http.Request, schedules []*models.ScheduledMessage) {
+	views := make([]ScheduledMessageView, len(schedules))
+	for i, s := range schedules {
+		views[i] = buildScheduledMessageView(s)
+	}
+	RenderDataResponse(w, r, views)
+}
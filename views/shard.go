@@ -0,0 +1,34 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type MessageShardView struct {
+	Type      string `json:"type"`
+	ShardId   string `json:"shard_id"`
+	Index     int64  `json:"index"`
+	OwnerId   string `json:"owner_id"`
+	ExpiredAt string `json:"expired_at"`
+	Pending   int64  `json:"pending"`
+}
+
+func RenderMessageShards(w http.ResponseWriter, r *http.Request, shards []*models.MessageShard) {
+	views := make([]MessageShardView, len(shards))
+	for i, s := range shards {
+		views[i] = MessageShardView{
+			Type:    "shard",
+			ShardId: s.ShardId,
+			Index:   s.Index,
+			OwnerId: s.OwnerId,
+			Pending: s.Pending,
+		}
+		if !s.ExpiredAt.IsZero() {
+			views[i].ExpiredAt = s.ExpiredAt.Format(time.RFC3339Nano)
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
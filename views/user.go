@@ -23,6 +23,10 @@ type AccountView struct {
 	AuthenticationToken string `json:"authentication_token"`
 	TraceId             string `json:"trace_id"`
 	State               string `json:"state"`
+	Plan                string `json:"plan"`
+	ExpiresAt           string `json:"expires_at"`
+	InvitationCode      string `json:"invitation_code"`
+	ReferrerId          string `json:"referrer_id"`
 }
 
 func buildUserView(user *models.User) UserView {
@@ -55,6 +59,30 @@ func RenderAccount(w http.ResponseWriter, r *http.Request, user *models.User) {
 		AuthenticationToken: user.AuthenticationToken,
 		TraceId:             user.TraceId,
 		State:               user.State,
+		Plan:                user.Plan,
+		InvitationCode:      user.InvitationCode,
+		ReferrerId:          user.ReferrerId,
+	}
+	if !user.ExpiresAt.IsZero() {
+		userView.ExpiresAt = user.ExpiresAt.Format(time.RFC3339Nano)
 	}
 	RenderDataResponse(w, r, userView)
 }
+
+type MuteView struct {
+	Type       string    `json:"type"`
+	UserId     string    `json:"user_id"`
+	OperatorId string    `json:"operator_id"`
+	ExpiredAt  time.Time `json:"expired_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func RenderMute(w http.ResponseWriter, r *http.Request, mute *models.Mute) {
+	RenderDataResponse(w, r, MuteView{
+		Type:       "mute",
+		UserId:     mute.UserId,
+		OperatorId: mute.OperatorId,
+		ExpiredAt:  mute.ExpiredAt,
+		CreatedAt:  mute.CreatedAt,
+	})
+}
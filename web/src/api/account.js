@@ -21,13 +21,18 @@ const Account = {
     return await api.post('/users/'+id+'/remove', {}, {})
   },
 
+  refer: async function (referrer) {
+    return await api.post('/account/referrer', {"referrer": referrer}, {})
+  },
+
   block: async function (id) {
     return await api.post('/users/'+id+'/block', {}, {})
   },
 
-  authenticate: async function (authorizationCode) {
+  authenticate: async function (authorizationCode, referrer) {
     var params = {
-      "code": authorizationCode
+      "code": authorizationCode,
+      "referrer": referrer || ""
     };
     let resp = await api.post('/auth', params, {})
     if (resp.data) {
@@ -46,6 +51,10 @@ const Account = {
     return window.localStorage.getItem('role');
   },
 
+  isOperator: function (role) {
+    return ['owner', 'admin', 'moderator'].indexOf(role || window.localStorage.getItem('role')) >= 0;
+  },
+
   token: function () {
     return window.localStorage.getItem('token');
   },
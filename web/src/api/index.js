@@ -5,5 +5,6 @@ export default {
   property: require('./property').default,
   packet: require('./packet').default,
   broadcaster: require('./broadcaster').default,
+  invitation: require('./invitation').default,
   net: require('./net').default,
 }
@@ -0,0 +1,13 @@
+const api = require('./net').default
+
+let Invitation = {
+  async show (code) {
+    return await api.get('/invitations/' + code, {})
+  },
+
+  async redeem (code) {
+    return await api.post('/invitations/' + code + '/redeem', {}, {})
+  }
+}
+
+export default Invitation;